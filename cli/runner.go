@@ -1,10 +1,12 @@
 package cli
 
 import (
+	"context"
 	"github.com/Masterminds/cookoo"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 
 	"strings"
 )
@@ -84,6 +86,9 @@ type Runner struct {
 
 	summary, usage string
 	flags *flag.FlagSet
+
+	// release undoes CancelOn once a run is over.
+	release func()
 }
 
 // Help sets the help text and support flags for the app.
@@ -96,6 +101,70 @@ func (r *Runner) Help(summary, usage string, flags *flag.FlagSet) *Runner {
 	return r
 }
 
+// CancelOn cancels the running route when one of the given signals arrives.
+//
+// A cancelable context.Context is attached to the runner's context (see
+// cookoo.SetStdContext). When a signal is received, the context is canceled,
+// the router stops before the next command, and Run or RunSubcommand returns
+// a *cookoo.Canceled error. Long-running commands can watch
+// cookoo.StdContext(cxt).Done() to stop early.
+//
+// Only the first signal is trapped. A second signal gets the default
+// behavior, which usually terminates the program.
+//
+// If no signals are given, os.Interrupt is used.
+//
+// When Run or RunSubcommand returns, the signals are released, and the
+// context.Context that was attached before CancelOn is put back, so CancelOn
+// applies to a single run. Later requests on the context run as usual.
+//
+// 	cli.New(reg, router, cxt).Help(Summary, Description, flags).
+// 		CancelOn(os.Interrupt).
+// 		Run("hello")
+func (r *Runner) CancelOn(sigs ...os.Signal) *Runner {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt}
+	}
+	parent := cookoo.StdContext(r.cxt)
+	ctx, cancel := context.WithCancel(parent)
+	cookoo.SetStdContext(r.cxt, ctx)
+
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, sigs...)
+	go func() {
+		select {
+		case s := <-sig:
+			signal.Stop(sig)
+			r.cxt.Logf("info", "Received signal %s. Canceling.", s)
+			cancel()
+		case <-done:
+		}
+	}()
+
+	prev := r.release
+	r.release = func() {
+		signal.Stop(sig)
+		// Put the parent back first, so later requests on the context do not
+		// see it canceled.
+		cookoo.SetStdContext(r.cxt, parent)
+		cancel()
+		close(done)
+		if prev != nil {
+			prev()
+		}
+	}
+	return r
+}
+
+// done releases anything CancelOn set up.
+func (r *Runner) done() {
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+}
+
 // Subcommand sets up the basics for a subcommand.
 //
 // It creates a route complete with help and flags parser, then returns that
@@ -221,6 +290,7 @@ func (r *Runner) startup() {
 //
 // Additionally, the command `help` is predefined to generate help text.
 func (r *Runner) Run(route string) error {
+	defer r.done()
 	r.startup()
 	if err := r.router.HandleRequest("@startup", r.cxt, false); err != nil {
 		fmt.Printf("Failed to startup: %s", err)
@@ -248,6 +318,7 @@ func (r *Runner) Run(route string) error {
 //
 //
 func (r *Runner) RunSubcommand() error {
+	defer r.done()
 	r.startup()
 	shelp := subcommandHelp(r.reg)
 	r.cxt.Put("subcommandHelp", shelp)
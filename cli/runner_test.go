@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"github.com/Masterminds/cookoo"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCancelOn(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	app := New(reg, router, cxt).CancelOn(syscall.SIGUSR1)
+
+	ctx := cookoo.StdContext(app.cxt)
+	if ctx.Err() != nil {
+		t.Fatal("! Context should not start canceled.")
+	}
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Signal(syscall.SIGUSR1)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("! Expected signal to cancel the context.")
+	}
+
+	reg.Route("test", "Testing cancel.").Does(cookoo.AddToContext, "added")
+	err = router.HandleRequest("test", cxt, false)
+	if _, ok := err.(*cookoo.Canceled); !ok {
+		t.Errorf("! Expected a *cookoo.Canceled, got %v", err)
+	}
+}
+
+func TestCancelOnReleased(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	// Skip the default startup, which parses the test binary's flags.
+	reg.Route("@startup", "Nothing to start.")
+	reg.Route("test", "Testing release.").Does(cookoo.AddToContext, "added")
+	app := New(reg, router, cxt).CancelOn(syscall.SIGUSR2)
+	if app.release == nil {
+		t.Fatal("! Expected CancelOn to set up a release.")
+	}
+
+	if err := app.Run("test"); err != nil {
+		t.Fatalf("! Unexpected error: %s", err)
+	}
+	if app.release != nil {
+		t.Error("! Expected the run to release the signals.")
+	}
+	if err := cookoo.StdContext(cxt).Err(); err != nil {
+		t.Errorf("! Expected the context to be usable after the run, got %s", err)
+	}
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Errorf("! Expected a later request to succeed, got %s", err)
+	}
+	if err := app.Run("test"); err != nil {
+		t.Errorf("! Expected a second run to succeed, got %s", err)
+	}
+}
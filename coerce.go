@@ -0,0 +1,311 @@
+package cookoo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamTypes are the types a param can be given with WithType or Typed.
+//
+// 	string   - a string
+// 	int      - an int
+// 	int64    - an int64
+// 	uint64   - a uint64
+// 	float64  - a float64
+// 	bool     - a bool (from strconv.ParseBool, or "on"/"off")
+// 	duration - a time.Duration (from time.ParseDuration)
+// 	time     - a time.Time (from RFC 3339, or a 2006-01-02 date)
+// 	[]string - a []string (from a comma separated string)
+// 	[]int    - an []int (from a comma separated string)
+//
+// Once a param has been coerced, the getters (GetInt, GetBool, and so on)
+// find it with the expected type.
+var ParamTypes = []string{"string", "int", "int64", "uint64", "float64", "bool", "duration", "time", "[]string", "[]int"}
+
+// ParamError indicates that a param could not be converted to the type it
+// was declared with.
+//
+// Like a FatalError, a ParamError stops the route.
+type ParamError struct {
+	Route   string
+	Command string
+	Param   string
+	// Type is the type the param was declared with.
+	Type  string
+	Value interface{}
+	Err   error
+}
+
+// Error describes the param that failed and why.
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("Route %s, command %s: param %s must be %s, got %T %v: %s", e.Route, e.Command, e.Param, e.Type, e.Value, e.Value, e.Err)
+}
+
+// typedDefault is a default value that declares the param's type.
+type typedDefault struct {
+	typ string
+	val interface{}
+}
+
+// Typed declares a param's type in the Route/Tasks syntax.
+//
+// It is used as a DefaultValue, along with the real default (which may be nil):
+//
+// 	cookoo.Param{Name: "limit", DefaultValue: cookoo.Typed("int", 10), From: "query:limit"}
+//
+// This is the same as Using("limit").WithType("int").WithDefault(10).From("query:limit").
+//
+// Like WithType, Typed panics if the type is not one of the ParamTypes.
+func Typed(typ string, defaultValue interface{}) interface{} {
+	mustBeParamType(typ)
+	return typedDefault{typ, defaultValue}
+}
+
+// WithType declares the type of the most recently specified parameter as set
+// by Using.
+//
+// When the param is resolved, its value (or its default) is converted to the
+// type. Strings are parsed, and numbers are converted between numeric types.
+// If the conversion fails, the command is not run, and the route fails with
+// a *ParamError. If no value is found and there is no default, the param is
+// nil, as usual.
+//
+// 	reg.Route("GET /posts", "List posts").
+// 		Does(ListPosts, "posts").
+// 		Using("limit").WithType("int").WithDefault(20).From("query:limit")
+//
+// See ParamTypes for the types that are understood. WithType panics if given
+// any other type.
+func (r *Registry) WithType(typ string) *Registry {
+	mustBeParamType(typ)
+	param := r.lastParamAdded()
+	param.typ = typ
+	return r
+}
+
+// mustBeParamType panics if typ is not one of the ParamTypes.
+func mustBeParamType(typ string) {
+	if !IsParamType(typ) {
+		panicString := fmt.Sprintf("Unknown param type %s.", typ)
+		panic(panicString)
+	}
+}
+
+// IsParamType reports whether typ is one of the ParamTypes.
+func IsParamType(typ string) bool {
+	for _, t := range ParamTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Coerce converts a value to one of the ParamTypes.
+//
+// A nil value is returned as nil.
+func Coerce(value interface{}, typ string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch typ {
+	case "string":
+		return coerceString(value)
+	case "int":
+		i, err := coerceInt(value)
+		if err == nil && int64(int(i)) != i {
+			err = fmt.Errorf("%d is out of range", i)
+		}
+		return int(i), err
+	case "int64":
+		return coerceInt(value)
+	case "uint64":
+		i, err := coerceInt(value)
+		if err == nil && i < 0 {
+			err = fmt.Errorf("%d is negative", i)
+		}
+		return uint64(i), err
+	case "float64":
+		return coerceFloat(value)
+	case "bool":
+		return coerceBool(value)
+	case "duration":
+		return coerceDuration(value)
+	case "time":
+		return coerceTime(value)
+	case "[]string":
+		return coerceStrings(value)
+	case "[]int":
+		return coerceInts(value)
+	}
+	return nil, fmt.Errorf("unknown type %s", typ)
+}
+
+// single unwraps a slice with one item, as query and form values often are.
+func single(value interface{}) interface{} {
+	if v, ok := value.([]string); ok && len(v) == 1 {
+		return v[0]
+	}
+	return value
+}
+
+func coerceString(value interface{}) (string, error) {
+	switch v := single(value).(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("cannot convert to a string")
+}
+
+func coerceInt(value interface{}) (int64, error) {
+	value = single(value)
+	if s, ok := value.(string); ok {
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return 0, fmt.Errorf("%d is out of range", v.Uint())
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != float64(int64(f)) {
+			return 0, fmt.Errorf("%v is not a whole number", f)
+		}
+		return int64(f), nil
+	}
+	return 0, fmt.Errorf("cannot convert to a number")
+}
+
+func coerceFloat(value interface{}) (float64, error) {
+	value = single(value)
+	if s, ok := value.(string); ok {
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return 0, fmt.Errorf("cannot convert to a number")
+}
+
+func coerceBool(value interface{}) (bool, error) {
+	switch v := single(value).(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(v))
+	}
+	return false, fmt.Errorf("cannot convert to a bool")
+}
+
+func coerceDuration(value interface{}) (time.Duration, error) {
+	switch v := single(value).(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(strings.TrimSpace(v))
+	}
+	return 0, fmt.Errorf("cannot convert to a duration")
+}
+
+func coerceTime(value interface{}) (time.Time, error) {
+	switch v := single(value).(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		v = strings.TrimSpace(v)
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		return time.Parse("2006-01-02", v)
+	}
+	return time.Time{}, fmt.Errorf("cannot convert to a time")
+}
+
+func coerceStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case string:
+		return splitList(v), nil
+	case []interface{}:
+		out := make([]string, len(v))
+		for i, item := range v {
+			s, err := coerceString(item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %s", i, err)
+			}
+			out[i] = s
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot convert to a list")
+}
+
+func coerceInts(value interface{}) ([]int, error) {
+	if v, ok := value.([]int); ok {
+		return v, nil
+	}
+	var items []interface{}
+	switch v := value.(type) {
+	case string:
+		for _, s := range splitList(v) {
+			items = append(items, s)
+		}
+	case []string:
+		for _, s := range v {
+			items = append(items, s)
+		}
+	case []interface{}:
+		items = v
+	default:
+		return nil, fmt.Errorf("cannot convert to a list")
+	}
+
+	out := make([]int, len(items))
+	for i, item := range items {
+		n, err := Coerce(item, "int")
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %s", i, err)
+		}
+		out[i] = n.(int)
+	}
+	return out, nil
+}
+
+// splitList splits a comma separated string. An empty string is an empty list.
+func splitList(s string) []string {
+	if len(strings.TrimSpace(s)) == 0 {
+		return []string{}
+	}
+	parts := strings.Split(s, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return parts
+}
@@ -0,0 +1,140 @@
+package cookoo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCoerce(t *testing.T) {
+	day := time.Date(2015, 6, 16, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		typ    string
+		in     interface{}
+		expect interface{}
+	}{
+		{"string", "hi", "hi"},
+		{"string", 10, "10"},
+		{"string", []string{"one"}, "one"},
+		{"int", "10", 10},
+		{"int", " -3 ", -3},
+		{"int", int64(7), 7},
+		{"int", 2.0, 2},
+		{"int", []string{"5"}, 5},
+		{"int64", "10", int64(10)},
+		{"uint64", 3, uint64(3)},
+		{"float64", "1.5", 1.5},
+		{"float64", 2, 2.0},
+		{"bool", "true", true},
+		{"bool", "on", true},
+		{"bool", "0", false},
+		{"duration", "1m30s", 90 * time.Second},
+		{"time", "2015-06-16T00:00:00Z", day},
+		{"time", "2015-06-16", day},
+		{"[]string", "a, b,c", []string{"a", "b", "c"}},
+		{"[]string", []interface{}{"a", 1}, []string{"a", "1"}},
+		{"[]int", "1,2", []int{1, 2}},
+		{"[]int", []string{"3"}, []int{3}},
+		{"int", nil, nil},
+	}
+	for _, tt := range tests {
+		out, err := Coerce(tt.in, tt.typ)
+		if err != nil {
+			t.Errorf("! Coerce(%#v, %s): %s", tt.in, tt.typ, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, tt.expect) {
+			t.Errorf("! Coerce(%#v, %s): expected %#v, got %#v", tt.in, tt.typ, tt.expect, out)
+		}
+	}
+
+	bad := []struct {
+		typ string
+		in  interface{}
+	}{
+		{"int", "ten"},
+		{"int", 1.5},
+		{"uint64", -1},
+		{"bool", "maybe"},
+		{"duration", 10},
+		{"time", "June"},
+		{"[]int", "1,x"},
+		{"string", struct{}{}},
+		{"nope", 1},
+	}
+	for _, tt := range bad {
+		if _, err := Coerce(tt.in, tt.typ); err == nil {
+			t.Errorf("! Expected Coerce(%#v, %s) to fail", tt.in, tt.typ)
+		}
+	}
+}
+
+func TestTypedParams(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	cxt.Put("limit", "10")
+	cxt.Put("bad", "ten")
+
+	reg.Route("test", "Typed params").
+		Does(FetchParams, "params").
+		Using("limit").WithType("int").From("cxt:limit").
+		Using("debug").WithType("bool").WithDefault("on").
+		Using("missing").WithType("int").From("cxt:missing")
+
+	reg.AddRoute(Route{
+		Name: "bad",
+		Does: Tasks{
+			Cmd{
+				Name: "params",
+				Fn:   FetchParams,
+				Using: []Param{
+					{Name: "wait", DefaultValue: Typed("duration", "1s"), From: "cxt:bad"},
+				},
+			},
+		},
+	})
+
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	p := cxt.Get("params", nil).(*Params)
+	if GetInt("limit", 0, p) != 10 {
+		t.Errorf("! Expected limit to be the int 10, got %#v", p.Get("limit", nil))
+	}
+	if GetBool("debug", false, p) != true {
+		t.Errorf("! Expected the default to be coerced, got %#v", p.Get("debug", nil))
+	}
+	if v, ok := p.Has("missing"); ok {
+		t.Errorf("! Expected a missing param to be nil, got %#v", v)
+	}
+
+	cxt.Put("params", nil)
+	err := router.HandleRequest("bad", cxt, false)
+	perr, ok := err.(*ParamError)
+	if !ok {
+		t.Fatalf("! Expected a ParamError, got %#v", err)
+	}
+	if perr.Route != "bad" || perr.Command != "params" || perr.Param != "wait" || perr.Type != "duration" || perr.Value != "ten" {
+		t.Errorf("! Unexpected ParamError: %#v", perr)
+	}
+	if cxt.Get("params", nil) != nil {
+		t.Error("! Expected the command not to run.")
+	}
+}
+
+func TestWithTypeUnknown(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("! Expected WithType to panic on an unknown type.")
+		}
+	}()
+	NewRegistry().Route("test", "").Does(FetchParams, "params").Using("a").WithType("integer")
+}
+
+func TestTypedUnknown(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("! Expected Typed to panic on an unknown type.")
+		}
+	}()
+	Typed("itn", nil)
+}
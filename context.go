@@ -3,9 +3,12 @@ package cookoo
 // Copyright 2013, 1014 Masterminds
 
 import (
+	"context"
+	"fmt"
 	cio "github.com/Masterminds/cookoo/io"
 	"io"
 	"log"
+	"sync"
 )
 
 // A Context is a collection of data that is associated with the current
@@ -138,6 +141,68 @@ type ExecutionContext struct {
 	loggers          io.Writer
 	loggerRegistered bool
 	skiplist         map[string]bool
+
+	// The logger is shared with copies of the context.
+	logger *contextLogger
+	// logTag starts every message, and holds the request ID, if there is one.
+	logTag string
+}
+
+// RedirectGlobalLog restores the old behavior of AddLogger.
+//
+// Originally, the first call to AddLogger on an ExecutionContext sent the
+// output of Go's global logger (the log package) to the context's loggers.
+// That captured logging from every library in the program, and the last
+// context to add a logger won. Now, the context logs through a logger of its
+// own, and the global logger is left alone.
+//
+// Set this to true to send the global logger to the context's loggers again.
+// It must be set before AddLogger is called.
+var RedirectGlobalLog = false
+
+// contextLogger writes log messages for a context and its copies.
+//
+// The prefix is set for each message, so the mutex keeps concurrent messages
+// from getting each other's prefixes.
+type contextLogger struct {
+	mutex  sync.Mutex
+	logger *log.Logger
+}
+
+// fallbackWriter writes to a context's loggers or, if it has none, to the
+// output of Go's global logger (stderr, unless it was changed). Without it, a
+// context with no loggers would drop every message.
+type fallbackWriter struct {
+	loggers *cio.MultiWriter
+}
+
+func (w fallbackWriter) Write(p []byte) (int, error) {
+	if w.loggers.Len() == 0 {
+		return log.Writer().Write(p)
+	}
+	return w.loggers.Write(p)
+}
+
+func newContextLogger(out io.Writer) *contextLogger {
+	return &contextLogger{logger: log.New(out, "", log.LstdFlags)}
+}
+
+// raw writes a line exactly as given.
+func (l *contextLogger) raw(line []byte) {
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line[:len(line):len(line)], '\n')
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.logger.Writer().Write(line)
+}
+
+// output writes one message with the given prefix.
+func (l *contextLogger) output(prefix, msg string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.logger.SetPrefix(prefix)
+	l.logger.Output(3, msg)
 }
 
 // KeyValueDatasource is a datasource that can retrieve values by (string) keys.
@@ -163,6 +228,7 @@ func (cxt *ExecutionContext) Init() *ExecutionContext {
 	cxt.datasources = make(map[string]Datasource)
 	cxt.values = make(map[string]ContextValue)
 	cxt.loggers = cio.NewMultiWriter()
+	cxt.logger = newContextLogger(fallbackWriter{cxt.loggers.(*cio.MultiWriter)})
 	cxt.loggerRegistered = false
 	cxt.skiplist = map[string]bool{}
 	return cxt
@@ -178,6 +244,12 @@ func (cxt *ExecutionContext) Add(name string, value ContextValue) {
 // Put inserts a value into the context.
 func (cxt *ExecutionContext) Put(name string, value ContextValue) {
 	cxt.values[name] = value
+	if name == RequestIDKey {
+		cxt.logTag = ""
+		if id := fmt.Sprint(value); value != nil && len(id) > 0 {
+			cxt.logTag = "[" + id + "] "
+		}
+	}
 }
 
 // AsMap returns the values of the context as a map keyed by a string.
@@ -251,12 +323,14 @@ func (cxt *ExecutionContext) Logger(name string) (io.Writer, bool) {
 
 // AddLogger adds a logger. The logging system can have one of more loggers keyed
 // by name.
+//
+// Go's global logger is not affected, unless RedirectGlobalLog is set.
 func (cxt *ExecutionContext) AddLogger(name string, logger io.Writer) {
 	cxt.loggers.(*cio.MultiWriter).AddWriter(name, logger)
 
 	// Waiting until the first logger is attached before telling the Go log
 	// system what the output is.
-	if cxt.loggerRegistered == false {
+	if RedirectGlobalLog && cxt.loggerRegistered == false {
 		log.SetOutput(cxt.loggers)
 		cxt.loggerRegistered = true
 	}
@@ -287,14 +361,19 @@ func (cxt *ExecutionContext) SkipLogPrefix(prefixes ...string) {
 }
 
 // Log logs a message to one of more loggers.
+//
+// The message is formatted as with log.Print, and written with the prefix to
+// every logger on the context. It is safe to log from many goroutines at once.
+// A context with no loggers writes to the output of Go's global logger, which
+// is stderr unless it has been changed.
+//
+// If the context has a request ID (see RequestIDKey), the message starts with
+// it.
 func (cxt *ExecutionContext) Log(prefix string, v ...interface{}) {
 	if _, ok := cxt.skiplist[prefix]; ok {
 		return
 	}
-	tmpPrefix := log.Prefix()
-	log.SetPrefix(prefix)
-	log.Print(v...)
-	log.SetPrefix(tmpPrefix)
+	cxt.logger.output(prefix, cxt.logTag+fmt.Sprint(v...))
 }
 
 // Logf logs a message to one or more loggers and uses a format string.
@@ -302,10 +381,23 @@ func (cxt *ExecutionContext) Logf(prefix string, format string, v ...interface{}
 	if _, ok := cxt.skiplist[prefix]; ok {
 		return
 	}
-	tmpPrefix := log.Prefix()
-	log.SetPrefix(prefix)
-	log.Printf(format, v...)
-	log.SetPrefix(tmpPrefix)
+	cxt.logger.output(prefix, cxt.logTag+fmt.Sprintf(format, v...))
+}
+
+// RawLogger is implemented by contexts that can log a line that has already
+// been formatted, such as a structured log record.
+//
+// ExecutionContext and the contexts returned by SyncContext are RawLoggers.
+type RawLogger interface {
+	LogRaw(line []byte)
+}
+
+// LogRaw writes a line to every logger, without a prefix or a timestamp.
+//
+// A newline is added if the line does not end with one. Like Log, it is safe
+// to call from many goroutines at once.
+func (cxt *ExecutionContext) LogRaw(line []byte) {
+	cxt.logger.raw(line)
 }
 
 // Len returns the length of the context as in the length of the values stores.
@@ -329,8 +421,49 @@ func (cxt *ExecutionContext) Copy() Context {
 
 	newEC := newCxt.(*ExecutionContext)
 	newEC.loggers = cxt.loggers 
+	newEC.logger = cxt.logger
 	newEC.skiplist = cxt.skiplist
 	newEC.loggerRegistered = cxt.loggerRegistered
 
 	return newCxt
 }
+
+// StdContextKey is the context key under which a context.Context is stored.
+const StdContextKey = "context.Context"
+
+// RequestIDKey is the context key for the ID of the request being handled.
+//
+// When it is set, every message from Log and Logf on an ExecutionContext
+// starts with the ID in brackets, so the lines for one request can be found
+// together:
+//
+// 	info2015/06/16 12:00:00 [4bf92f3577b34da6] Handling request for GET /
+//
+// The web.CookooHandler sets it for each HTTP request.
+const RequestIDKey = "request.ID"
+
+// SetStdContext attaches a standard library context.Context to a Context.
+//
+// The router checks the attached context.Context before running each
+// command, and aborts the route with a Canceled interrupt once it is done.
+// The web.CookooHandler attaches the http.Request's context, so a request
+// stops running when the client goes away.
+//
+// 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// 	defer cancel()
+// 	cookoo.SetStdContext(cxt, ctx)
+// 	err := router.HandleRequest("slow", cxt, false)
+func SetStdContext(cxt Context, ctx context.Context) {
+	cxt.Put(StdContextKey, ctx)
+}
+
+// StdContext returns the context.Context attached to a Context.
+//
+// If none has been attached, context.Background() is returned, so the
+// result is always safe to use.
+func StdContext(cxt Context) context.Context {
+	if ctx, ok := cxt.Get(StdContextKey, nil).(context.Context); ok && ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
@@ -5,10 +5,14 @@ package cookoo
 
 import (
 	"bytes"
+	"fmt"
 	"log"
+	"os"
 	"reflect"
 	"regexp"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -130,6 +134,13 @@ func TestCopy(t *testing.T) {
 }
 
 func TestLogging(t *testing.T) {
+	// The global logger is only redirected on request.
+	RedirectGlobalLog = true
+	defer func() {
+		RedirectGlobalLog = false
+		log.SetOutput(os.Stderr)
+	}()
+
 	logger := new(bytes.Buffer)
 	c := NewContext()
 	c.AddLogger("test", logger)
@@ -196,3 +207,104 @@ func TestLogging(t *testing.T) {
 	}
 
 }
+
+func TestLoggingIsolated(t *testing.T) {
+	global := new(bytes.Buffer)
+	log.SetOutput(global)
+	defer log.SetOutput(os.Stderr)
+
+	logger := new(bytes.Buffer)
+	c := NewContext()
+	c.AddLogger("test", logger)
+	c.Log("foo", "to the context")
+	log.Print("to the global logger")
+
+	if strings.Contains(global.String(), "to the context") {
+		t.Error("! Expected context logging to stay off of the global logger.")
+	}
+	if strings.Contains(logger.String(), "to the global logger") {
+		t.Error("! Expected the global logger not to be redirected.")
+	}
+	if !strings.HasPrefix(logger.String(), "foo") {
+		t.Errorf("! Expected a prefixed message, got %q", logger.String())
+	}
+}
+
+func TestLoggingFallback(t *testing.T) {
+	global := new(bytes.Buffer)
+	log.SetOutput(global)
+	defer log.SetOutput(os.Stderr)
+
+	// With no loggers, messages go to the global logger's output.
+	c := NewContext()
+	c.Logf("info", "hello %s", "there")
+	if !strings.HasPrefix(global.String(), "info") || !strings.Contains(global.String(), "hello there") {
+		t.Errorf("! Expected the message on the global output, got %q", global.String())
+	}
+
+	// Once a logger is added, they go there instead.
+	global.Reset()
+	logger := new(bytes.Buffer)
+	c.AddLogger("test", logger)
+	c.Log("info", "to the logger")
+	if global.Len() > 0 || !strings.Contains(logger.String(), "to the logger") {
+		t.Errorf("! Expected the message on the logger only, got %q and %q", global.String(), logger.String())
+	}
+}
+
+func TestLoggingConcurrent(t *testing.T) {
+	logger := new(bytes.Buffer)
+	c := NewContext()
+	c.AddLogger("test", logger)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Copies share the logger, as a request's context would.
+			c.Copy().Logf(fmt.Sprintf("p%d ", i), "m%d", i)
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(logger.String()), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("! Expected 20 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var p, m int
+		fields := strings.Fields(line)
+		fmt.Sscanf(fields[0], "p%d", &p)
+		fmt.Sscanf(fields[len(fields)-1], "m%d", &m)
+		if p != m {
+			t.Errorf("! Prefix and message do not match: %q", line)
+		}
+	}
+}
+
+func TestLoggingRequestID(t *testing.T) {
+	cxt := NewContext()
+	var b bytes.Buffer
+	cxt.AddLogger("buffer", &b)
+
+	cxt.Put(RequestIDKey, "abc123")
+	cxt.Copy().Logf("info", "Hello %s", "there")
+	cxt.(RawLogger).LogRaw([]byte("raw line"))
+	cxt.Put(RequestIDKey, "")
+	cxt.Log("info", "Untagged")
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("! Expected 3 lines, got %q", b.String())
+	}
+	if !strings.HasSuffix(lines[0], " [abc123] Hello there") {
+		t.Errorf("! Expected the request ID on a copy's messages, got %q", lines[0])
+	}
+	if lines[1] != "raw line" {
+		t.Errorf("! Expected raw lines to be left alone, got %q", lines[1])
+	}
+	if strings.Contains(lines[2], "[") {
+		t.Errorf("! Expected no tag once the ID is cleared, got %q", lines[2])
+	}
+}
@@ -0,0 +1,254 @@
+package cookoo
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// LoopIndexKey is the context key that holds the index of the current item in
+// a ForEach loop.
+const LoopIndexKey = "loop.Index"
+
+// LoopValueKey is the context key that holds the current item in a ForEach
+// loop.
+const LoopValueKey = "loop.Value"
+
+// When is a Task that runs its Tasks only if a condition is true.
+//
+// Cond is either the name of a context value or a func(Context) bool. A
+// context value is true if it is set and is not nil, false, zero, or empty.
+//
+// 	cookoo.When{
+// 		Cond: "user",
+// 		Does: cookoo.Tasks{
+// 			cookoo.Cmd{Name: "prefs", Fn: LoadPrefs},
+// 		},
+// 	}
+//
+// See Registry.When.
+type When struct {
+	Cond interface{}
+	Does Tasks
+}
+
+func (w When) getParams() Parameters {
+	return Parameters{}
+}
+
+// Unless is a Task that runs its Tasks only if a condition is false.
+//
+// Cond works just as it does for When.
+type Unless struct {
+	Cond interface{}
+	Does Tasks
+}
+
+func (u Unless) getParams() Parameters {
+	return Parameters{}
+}
+
+// ForEach is a Task that runs its Tasks once for every item in a list.
+//
+// In is the name of a context value that holds a slice or an array.
+//
+// See Registry.ForEach.
+type ForEach struct {
+	In   string
+	Does Tasks
+}
+
+func (f ForEach) getParams() Parameters {
+	return Parameters{}
+}
+
+// When starts a block of commands that only run if the condition is true.
+//
+// The condition is either the name of a context value or a
+// func(cookoo.Context) bool, and is checked when the route reaches the block.
+// A context value is true if it is set and is not nil, false, zero, or empty.
+//
+// 	reg.Route("GET /", "The home page").
+// 		Does(LoadUser, "user").
+// 		When("user").
+// 			Does(LoadPrefs, "prefs").Using("user").From("cxt:user").
+// 		End().
+// 		Does(Render, "render")
+//
+// The commands in the block are part of the route, just as if they had been
+// added without the block: their results go into the context, and their
+// interrupts are handled as usual. A Reroute or a Stop inside of the block
+// ends the whole route.
+//
+// Blocks may be nested, but they may not be placed inside of a Parallel
+// group.
+func (r *Registry) When(cond interface{}) *Registry {
+	spec, err := whenSpec("when", cond, false)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r.openControl(spec)
+}
+
+// Unless starts a block of commands that only run if the condition is false.
+//
+// It is the opposite of When.
+func (r *Registry) Unless(cond interface{}) *Registry {
+	spec, err := whenSpec("unless", cond, true)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r.openControl(spec)
+}
+
+// ForEach starts a block of commands that run once for every item in a list.
+//
+// The list is the context value with the given name, and may be any slice or
+// array. While the block runs, the index and value of the current item are in
+// the context as `loop.Index` and `loop.Value`:
+//
+// 	reg.Route("POST /invite", "Invite people").
+// 		Does(ParseEmails, "emails").
+// 		ForEach("emails").
+// 			Does(SendInvite, "invite").Using("to").From("cxt:loop.Value").
+// 		End()
+//
+// When the loop ends, `loop.Index` and `loop.Value` are put back the way they
+// were before it started, so a loop nested inside of another leaves the outer
+// loop's item in place. If they were not set before, they are left set to the
+// last item.
+//
+// If the value is not set, or is nil, the commands do not run at all. If it
+// is something other than a slice or an array, the loop fails with a
+// FatalError.
+//
+// Interrupts work as they do in a When block: a Reroute or a Stop ends the
+// route, and a RecoverableError goes on to the next command.
+func (r *Registry) ForEach(name string) *Registry {
+	return r.openControl(forEachSpec(name))
+}
+
+// openControl adds a When, Unless, or ForEach block and opens it.
+func (r *Registry) openControl(spec *commandSpec) *Registry {
+	r.addCommand(spec)
+	r.openBlocks = append(r.openBlocks, spec)
+	return r
+}
+
+// whenSpec creates the spec for a When or Unless block.
+func whenSpec(kind string, cond interface{}, negate bool) (*commandSpec, error) {
+	var test func(Context) bool
+	name := kind
+	switch cond := cond.(type) {
+	case string:
+		test = func(c Context) bool {
+			v, _ := c.Has(cond)
+			return truthy(v)
+		}
+		name = kind + ":" + cond
+	case func(Context) bool:
+		test = cond
+	default:
+		return nil, fmt.Errorf("Condition for %s must be a context name or a func(Context) bool, not %T.", kind, cond)
+	}
+
+	if negate {
+		inner := test
+		test = func(c Context) bool {
+			return !inner(c)
+		}
+	}
+	return &commandSpec{name: name, block: &blockSpec{kind: whenBlock, cond: test}}, nil
+}
+
+// forEachSpec creates the spec for a ForEach block.
+func forEachSpec(over string) *commandSpec {
+	return &commandSpec{name: "foreach:" + over, block: &blockSpec{kind: forEachBlock, over: over}}
+}
+
+// truthy decides whether a context value counts as true for a condition.
+func truthy(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Bool:
+		return val.Bool()
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array, reflect.Chan:
+		return val.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return val.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return val.Float() != 0
+	case reflect.Ptr, reflect.Interface, reflect.Func:
+		return !val.IsNil()
+	}
+	return true
+}
+
+// runControl runs a When, Unless, or ForEach block.
+//
+// The block is traced like a command. For a When or Unless, its result is
+// whether the condition held. For a ForEach, it is the number of items.
+func (r *Router) runControl(spec *routeSpec, cmd *commandSpec, rev *RouteEvent, cxt Context) (done bool, err error) {
+	ev := &CommandEvent{Name: cmd.name, Route: rev}
+	rev.Commands = append(rev.Commands, ev)
+	ev.Start = time.Now()
+	r.traceCommandStart(cxt, ev)
+
+	var irq Interrupt
+	switch cmd.block.kind {
+	case whenBlock:
+		ok := cmd.block.cond(cxt)
+		ev.Result = ok
+		if ok {
+			done, err = r.runChain(spec, cmd.block.commands, rev, cxt)
+		}
+	case forEachBlock:
+		ev.Result, irq, done, err = r.runForEach(spec, cmd, rev, cxt)
+	}
+
+	ev.Duration = time.Since(ev.Start)
+	ev.Interrupt = irq
+	r.traceCommandEnd(cxt, ev)
+
+	if irq != nil {
+		return r.handleInterrupt(spec, cmd, ev, irq, cxt)
+	}
+	return done, err
+}
+
+// runForEach runs the commands in a ForEach block for every item.
+//
+// The interrupt is set if the loop could not start.
+func (r *Router) runForEach(spec *routeSpec, cmd *commandSpec, rev *RouteEvent, cxt Context) (count int, irq Interrupt, done bool, err error) {
+	list, _ := cxt.Has(cmd.block.over)
+	if list == nil {
+		return 0, nil, false, nil
+	}
+	items := reflect.ValueOf(list)
+	if k := items.Kind(); k != reflect.Slice && k != reflect.Array {
+		return 0, &FatalError{fmt.Sprintf("Cannot loop over %s: %T is not a slice.", cmd.block.over, list)}, false, nil
+	}
+
+	// Put back the index and value from before the loop.
+	if index, ok := cxt.Has(LoopIndexKey); ok {
+		value := cxt.Get(LoopValueKey, nil)
+		defer func() {
+			cxt.Put(LoopIndexKey, index)
+			cxt.Put(LoopValueKey, value)
+		}()
+	}
+
+	for i := 0; i < items.Len(); i++ {
+		cxt.Put(LoopIndexKey, i)
+		cxt.Put(LoopValueKey, items.Index(i).Interface())
+		if done, err = r.runChain(spec, cmd.block.commands, rev, cxt); done {
+			return i + 1, nil, done, err
+		}
+	}
+	return items.Len(), nil, false, nil
+}
@@ -0,0 +1,205 @@
+package cookoo
+
+import (
+	"testing"
+)
+
+// collect appends the "item" param to the "collected" context value.
+func collect(c Context, p *Params) (interface{}, Interrupt) {
+	collected := c.Get("collected", []interface{}{}).([]interface{})
+	c.Put("collected", append(collected, p.Get("item", nil)))
+	return true, nil
+}
+
+func TestWhen(t *testing.T) {
+	reg, router, cxt := Cookoo()
+
+	reg.Route("test", "Test conditions").
+		Does(AddToContext, "setup").Using("yes").WithDefault("yes").Using("no").WithDefault(0).
+		When("yes").
+		Does(MockCommand, "whenYes").
+		End().
+		When("no").
+		Does(MockCommand, "whenNo").
+		End().
+		Unless("missing").
+		Does(MockCommand, "unlessMissing").
+		When(func(c Context) bool { return c.Get("unlessMissing", false) == true }).
+		Does(MockCommand, "nested").
+		End().
+		End().
+		Unless("yes").
+		Does(MockCommand, "unlessYes").
+		End().
+		Does(MockCommand, "after")
+
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expect := range map[string]bool{
+		"whenYes":       true,
+		"whenNo":        false,
+		"unlessMissing": true,
+		"nested":        true,
+		"unlessYes":     false,
+		"after":         true,
+	} {
+		if _, ok := cxt.Has(name); ok != expect {
+			t.Errorf("! Expected %s to run: %t", name, expect)
+		}
+	}
+}
+
+func TestForEach(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	cxt.Put("list", []string{"a", "b"})
+	cxt.Put("inner", [2]int{1, 2})
+
+	reg.AddRoute(Route{
+		Name: "test",
+		Does: Tasks{
+			ForEach{
+				In: "list",
+				Does: Tasks{
+					Cmd{Name: "outer", Fn: collect, Using: []Param{{Name: "item", From: "cxt:loop.Value"}}},
+					ForEach{
+						In: "inner",
+						Does: Tasks{
+							Cmd{Name: "index", Fn: collect, Using: []Param{{Name: "item", From: "cxt:loop.Index"}}},
+						},
+					},
+					Cmd{Name: "restored", Fn: collect, Using: []Param{{Name: "item", From: "cxt:loop.Value"}}},
+				},
+			},
+			ForEach{In: "missing", Does: Tasks{Cmd{Name: "never", Fn: MockCommand}}},
+			When{Cond: "never", Does: Tasks{Cmd{Name: "never", Fn: MockCommand}}},
+		},
+	})
+
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []interface{}{"a", 0, 1, "a", "b", 0, 1, "b"}
+	collected := cxt.Get("collected", []interface{}{}).([]interface{})
+	if len(collected) != len(expect) {
+		t.Fatalf("! Expected %v, got %v", expect, collected)
+	}
+	for i, v := range expect {
+		if collected[i] != v {
+			t.Errorf("! Expected %v, got %v", expect, collected)
+			break
+		}
+	}
+	if _, ok := cxt.Has("never"); ok {
+		t.Error("! Expected an empty loop not to run.")
+	}
+}
+
+func TestControlInterrupts(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	cxt.Put("list", []int{1, 2, 3})
+	cxt.Put("notList", 5)
+
+	reg.Route("stop", "Stop inside a loop").
+		ForEach("list").
+		Does(collect, "collect").Using("item").From("cxt:loop.Value").
+		When(func(c Context) bool { return c.Get(LoopIndexKey, 0) == 1 }).
+		Does(returns(nil, &Stop{}), "stop").
+		End().
+		End().
+		Does(MockCommand, "after")
+
+	reg.Route("fail", "Fail inside a block").
+		When("list").
+		Does(returns(nil, &FatalError{"Boom"}), "boom").
+		End()
+
+	reg.Route("catch", "Catch a bad loop").
+		ForEach("notList").
+		Does(MockCommand, "never").
+		End().
+		Catch("handler").
+		Does(MockCommand, "after")
+
+	reg.Route("handler", "Handle errors").Does(FetchParams, "handled").Using("cmd").From("cxt:error.Command")
+
+	if err := router.HandleRequest("stop", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(cxt.Get("collected", nil).([]interface{})); n != 2 {
+		t.Errorf("! Expected a Stop to end the loop after 2 items, got %d", n)
+	}
+	if _, ok := cxt.Has("after"); ok {
+		t.Error("! Expected a Stop in a loop to end the route.")
+	}
+
+	err := router.HandleRequest("fail", cxt, false)
+	if err == nil || err.Error() != "Boom" {
+		t.Errorf("! Expected error from inside of a block, got %v", err)
+	}
+
+	if err := router.HandleRequest("catch", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := cxt.Get("handled", nil).(*Params); !ok || p.Get("cmd", nil) != "foreach:notList" {
+		t.Errorf("! Expected a bad loop to be caught, got %v", cxt.Get("handled", nil))
+	}
+	if _, ok := cxt.Has("after"); !ok {
+		t.Error("! Expected the route to go on after a caught loop.")
+	}
+}
+
+func TestControlInParallel(t *testing.T) {
+	reg := NewRegistry()
+	err := reg.AddRoute(Route{
+		Name: "test",
+		Does: Tasks{
+			Parallel{Name: "group", Does: Tasks{When{Cond: "x"}}},
+		},
+	})
+	if err == nil {
+		t.Error("! Expected an error for a When inside of a Parallel group.")
+	}
+
+	if err := reg.AddRoute(Route{Name: "bad", Does: Tasks{When{Cond: 5}}}); err == nil {
+		t.Error("! Expected an error for a bad condition.")
+	}
+
+	// Includes cannot copy a When into an open group, either.
+	reg.Route("cond", "Has a When").When("x").Does(MockCommand, "a").End()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("! Expected a panic for an included When inside of a Parallel group.")
+			}
+		}()
+		reg.Route("included", "Includes a When").Parallel("group", FailOnFatal).Includes("cond")
+	}()
+}
+
+func TestControlNeedsCommand(t *testing.T) {
+	reg := NewRegistry()
+	options := map[string]func(){
+		"When": func() {
+			reg.Route("when", "Catch on a When").When("x").Catch("handler")
+		},
+		"Unless": func() {
+			reg.Route("unless", "Using on an Unless").Unless("x").Using("v")
+		},
+		"ForEach": func() {
+			reg.Route("foreach", "Middleware on a ForEach").ForEach("items").UseOnCommand(recorder("mw"))
+		},
+	}
+	for name, fn := range options {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("! Expected a panic for a %s with no commands.", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
@@ -33,10 +33,18 @@
 // 	3. Stop: This will stop the current request, but not as an error.
 // 	4. Reroute: This will stop executing the current route, and switch to executing another route.
 //
+// A fifth, Canceled, is returned by the router itself when the
+// context.Context attached to a Context (see SetStdContext) is canceled or
+// its deadline passes while a route is running.
+//
 // To learn how to write Cookoo applications, you may wish to examine
 // the small Skunk application: https://github.com/technosophos/skunk.
 package cookoo
 
+import (
+	"fmt"
+)
+
 // VERSION provides the current version of Cookoo.
 const VERSION = "1.3.0"
 
@@ -131,3 +139,20 @@ type FatalError struct {
 func (err *FatalError) Error() string {
 	return err.Message
 }
+
+// Canceled indicates that a route was aborted because the context.Context
+// attached to the Context was canceled or passed its deadline.
+//
+// The router checks for cancellation before each command is run. Commands
+// that do long-running work may also return a Canceled interrupt themselves.
+// Err is the error reported by the context.Context (context.Canceled or
+// context.DeadlineExceeded).
+type Canceled struct {
+	Route string
+	Err   error
+}
+
+// Error returns the error message.
+func (err *Canceled) Error() string {
+	return fmt.Sprintf("Route %s aborted: %s", err.Route, err.Err)
+}
@@ -48,6 +48,10 @@ import (
 //
 // Conventionally, template variables should start with an initial capital.
 //
+// The template can build URLs from route names or aliases with the "url"
+// function, like `{{url "user.show" "id" .ID}}`. It uses the Registry in the
+// context (see cookoo.URLFunc).
+//
 // Returns a formatted string.
 func Template(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
 	format := cookoo.GetString("template", "", p)
@@ -57,7 +61,8 @@ func Template(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt
 
 	//c.Logf("debug", "Template %s is '%s'\n", name, format)
 
-	tpl, err := template.New(name).Parse(format)
+	funcs := template.FuncMap{"url": cookoo.URLFunc(c)}
+	tpl, err := template.New(name).Funcs(funcs).Parse(format)
 	if err != nil {
 		return "", err
 	}
@@ -54,3 +54,21 @@ func TestTemplate(t *testing.T) {
 		t.Errorf("Expected 'Hello lambkin', got %s", res)
 	}
 }
+
+func TestTemplateURL(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	cxt.Put(cookoo.RegistryKey, reg)
+
+	reg.Route("GET /users/{id}", "Show a user").Alias("user.show")
+	reg.Route("test", "Test").
+		Does(Template, "out").
+		Using("template").WithDefault(`{{url "user.show" "id" .ID}}`).
+		Using("ID").WithDefault(5)
+
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Errorf("Failed route: %s", err)
+	}
+	if res := cxt.Get("out", "nada"); res != "/users/5" {
+		t.Errorf("Expected '/users/5', got %s", res)
+	}
+}
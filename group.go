@@ -0,0 +1,151 @@
+package cookoo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Group adds routes that share a name prefix, leading commands, and
+// middleware.
+//
+// A Group is created with Registry.Group. Each route added through it has the
+// group's prefix joined to its name, starts with the group's setup tasks, and
+// is wrapped by the group's middleware (outside of the route's own):
+//
+// 	api := reg.Group("/api/v2").Includes("@auth").Use(Timer)
+//
+// 	// Adds "GET /api/v2/users", which runs the commands of @auth first.
+// 	api.Route("GET /users", "List users").Does(ListUsers, "users")
+//
+// 	// The Route/Tasks syntax works, too.
+// 	api.AddRoutes(cookoo.Route{
+// 		Name: "DELETE /users/{id}",
+// 		Help: "Delete a user",
+// 		Does: cookoo.Tasks{cookoo.Cmd{Name: "delete", Fn: DeleteUser}},
+// 	})
+//
+// If a route name begins with a verb (like "GET "), the prefix goes after the
+// verb. A prefix may have a verb of its own, which is used for routes that
+// do not.
+//
+// Group.Route returns the Registry, so the rest of the chain (Does, Using,
+// and so on) works as usual. Start each new route from the group, though:
+// calling Route on the Registry adds a route outside of the group.
+type Group struct {
+	registry   *Registry
+	prefix     string
+	setup      Tasks
+	middleware []Middleware
+}
+
+// Group creates a Group of routes whose names begin with prefix.
+func (r *Registry) Group(prefix string) *Group {
+	return &Group{registry: r, prefix: prefix}
+}
+
+// Group creates a group within this one. It has both prefixes, and the setup
+// tasks and middleware of this group come before its own.
+func (g *Group) Group(prefix string) *Group {
+	return &Group{
+		registry:   g.registry,
+		prefix:     joinRouteName(g.prefix, prefix),
+		setup:      append(Tasks{}, g.setup...),
+		middleware: append([]Middleware{}, g.middleware...),
+	}
+}
+
+// Prefix returns the group's prefix.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Includes adds the commands of other routes to the start of every route in
+// the group, as Registry.Includes does.
+//
+// The routes must exist before a route is added to the group.
+func (g *Group) Includes(routes ...string) *Group {
+	for _, route := range routes {
+		g.setup = append(g.setup, Include{route})
+	}
+	return g
+}
+
+// Setup adds tasks to the start of every route in the group.
+func (g *Group) Setup(tasks ...Task) *Group {
+	g.setup = append(g.setup, tasks...)
+	return g
+}
+
+// Use adds middleware that wraps every command on every route in the group.
+func (g *Group) Use(mw ...Middleware) *Group {
+	g.middleware = append(g.middleware, mw...)
+	return g
+}
+
+// Route adds a route to the group, and returns the Registry so the route can
+// be built with Does, Using, and so on.
+//
+// Like Registry.Includes, it panics if a route named by Includes does not
+// exist. The route is not added in that case.
+func (g *Group) Route(name, description string) *Registry {
+	r := g.registry
+
+	includes := []string{}
+	cmds, err := r.compileTasks(g.setup, &includes)
+	if err != nil {
+		panic(fmt.Sprintf("Could not set up route %s: %s", name, err))
+	}
+
+	r.Route(joinRouteName(g.prefix, name), description)
+	route := r.currentRoute
+	route.commands = append(route.commands, cmds...)
+	route.includes = append(route.includes, includes...)
+	route.middleware = append(route.middleware, g.middleware...)
+	return r
+}
+
+// AddRoutes adds routes to the group, using the Route/Tasks syntax.
+//
+// As with Registry.AddRoutes, if any route fails to compile, none of them
+// are added.
+func (g *Group) AddRoutes(routes ...Route) error {
+	grouped := make([]Route, len(routes))
+	for i, route := range routes {
+		route.Name = joinRouteName(g.prefix, route.Name)
+		route.Does = append(append(Tasks{}, g.setup...), route.Does...)
+		route.Use = append(append([]Middleware{}, g.middleware...), route.Use...)
+		grouped[i] = route
+	}
+	return g.registry.AddRoutes(grouped...)
+}
+
+// AddRoute adds a single route to the group.
+func (g *Group) AddRoute(route Route) error {
+	return g.AddRoutes(route)
+}
+
+// joinRouteName puts a prefix in front of a route name, after the name's
+// verb if it has one.
+func joinRouteName(prefix, name string) string {
+	pverb, ppath := splitRouteVerb(prefix)
+	verb, path := splitRouteVerb(name)
+	if len(verb) == 0 {
+		verb = pverb
+	}
+	if strings.HasSuffix(ppath, "/") && strings.HasPrefix(path, "/") {
+		ppath = ppath[:len(ppath)-1]
+	}
+	if len(verb) == 0 {
+		return ppath + path
+	}
+	return verb + " " + ppath + path
+}
+
+// splitRouteVerb splits a name like "GET /foo" into its verb and path. A name
+// with no verb is all path.
+func splitRouteVerb(name string) (string, string) {
+	if i := strings.Index(name, " "); i > 0 && !strings.Contains(name[:i], "/") {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
@@ -0,0 +1,137 @@
+package cookoo
+
+import (
+	"strings"
+	"testing"
+)
+
+// commandNames lists the names of the commands on a route.
+func commandNames(reg *Registry, route string) string {
+	spec, ok := reg.RouteSpec(route)
+	if !ok {
+		return "<missing>"
+	}
+	names := make([]string, len(spec.commands))
+	for i, c := range spec.commands {
+		names[i] = c.name
+	}
+	return strings.Join(names, " ")
+}
+
+func TestGroup(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.Route("@auth", "Checks credentials").Does(MockCommand, "auth")
+
+	api := reg.Group("/api/v2").Includes("@auth").Use(recorder("group"))
+	api.Route("GET /users", "List users").
+		UseOnRoute(recorder("route")).
+		Does(MockCommand, "users")
+	err := api.AddRoutes(Route{
+		Name: "DELETE /users/{id}",
+		Help: "Delete a user",
+		Does: Tasks{Cmd{Name: "delete", Fn: MockCommand}},
+		Use:  []Middleware{recorder("route")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Route("GET /outside", "Not in the group").Does(MockCommand, "outside")
+
+	expect := map[string]string{
+		"GET /api/v2/users":         "auth users",
+		"DELETE /api/v2/users/{id}": "auth delete",
+		"GET /outside":              "outside",
+	}
+	for route, cmds := range expect {
+		if got := commandNames(reg, route); got != cmds {
+			t.Errorf("! Expected %s to run %q, got %q", route, cmds, got)
+		}
+	}
+	if spec, _ := reg.RouteSpec("GET /api/v2/users"); len(spec.includes) != 1 || spec.includes[0] != "@auth" {
+		t.Errorf("! Expected the route to record the include, got %v", spec.includes)
+	}
+
+	for _, route := range []string{"GET /api/v2/users", "DELETE /api/v2/users/{id}"} {
+		cxt.Put("trail", []string{})
+		if err := router.HandleRequest(route, cxt, false); err != nil {
+			t.Fatal(err)
+		}
+		trail := strings.Join(cxt.Get("trail", nil).([]string), " ")
+		if !strings.HasPrefix(trail, "group route ") {
+			t.Errorf("! Expected group middleware outside route middleware on %s, got %q", route, trail)
+		}
+	}
+	cxt.Put("trail", []string{})
+	router.HandleRequest("GET /outside", cxt, false)
+	if len(cxt.Get("trail", nil).([]string)) != 0 {
+		t.Error("! Expected no group middleware outside the group.")
+	}
+}
+
+func TestNestedGroup(t *testing.T) {
+	reg, _, _ := Cookoo()
+	reg.Route("@auth", "Auth").Does(MockCommand, "auth")
+	reg.Route("@admin", "Admin").Does(MockCommand, "admin")
+
+	api := reg.Group("/api").Includes("@auth")
+	admin := api.Group("/admin").Includes("@admin")
+	admin.Route("POST /reset", "Reset").Does(MockCommand, "reset")
+	api.Route("GET /", "Index").Does(MockCommand, "index")
+
+	if got := commandNames(reg, "POST /api/admin/reset"); got != "auth admin reset" {
+		t.Errorf("! Unexpected commands %q", got)
+	}
+	// The inner group does not change the outer one.
+	if got := commandNames(reg, "GET /api/"); got != "auth index" {
+		t.Errorf("! Unexpected commands %q", got)
+	}
+
+	if err := reg.Group("/x").Includes("@nope").AddRoute(Route{Name: "GET /y"}); err == nil {
+		t.Error("! Expected an error for a missing include.")
+	}
+}
+
+func TestGroupFails(t *testing.T) {
+	reg := NewRegistry()
+	version := reg.Version()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("! Expected a panic for a missing include.")
+			}
+		}()
+		reg.Group("/api").Includes("@nope").Route("GET /", "Index")
+	}()
+	if names := reg.RouteNames(); len(names) != 0 || reg.Version() != version {
+		t.Errorf("! Expected no route to be added, got %v", names)
+	}
+
+	// The second route cannot be compiled, so neither is added.
+	err := reg.Group("/api").AddRoutes(
+		Route{Name: "GET /a", Does: Tasks{Cmd{Name: "a", Fn: MockCommand}}},
+		Route{Name: "GET /b", Does: Tasks{Include{"nope"}}},
+	)
+	if err == nil {
+		t.Error("! Expected an error for a missing include.")
+	}
+	if names := reg.RouteNames(); len(names) != 0 {
+		t.Errorf("! Expected no routes to be added, got %v", names)
+	}
+}
+
+func TestJoinRouteName(t *testing.T) {
+	tests := []struct{ prefix, name, expect string }{
+		{"/api/v2", "GET /users", "GET /api/v2/users"},
+		{"/api/v2/", "GET /users", "GET /api/v2/users"},
+		{"GET /api", "/users", "GET /api/users"},
+		{"GET /api", "POST /users", "POST /api/users"},
+		{"/api", "/users", "/api/users"},
+		{"admin.", "list", "admin.list"},
+	}
+	for _, tt := range tests {
+		if got := joinRouteName(tt.prefix, tt.name); got != tt.expect {
+			t.Errorf("! Expected %q + %q to be %q, got %q", tt.prefix, tt.name, tt.expect, got)
+		}
+	}
+}
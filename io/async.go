@@ -0,0 +1,127 @@
+package io
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed is returned when writing to a closed AsyncWriter.
+var ErrClosed = errors.New("writer is closed")
+
+// AsyncWriter writes to another writer in the background.
+//
+// Each Write copies the message onto a bounded queue and returns at once. A
+// goroutine writes the queued messages, in order, to the underlying writer.
+// When the queue is full, messages are dropped rather than making the caller
+// wait, and Dropped counts them.
+//
+// Errors from the underlying writer are reported on os.Stderr.
+//
+// An AsyncWriter can be used anywhere a writer can, including
+// Context.AddLogger:
+//
+// 	aw := io.NewAsyncWriter(conn, 1024)
+// 	defer aw.Close()
+// 	cxt.AddLogger("remote", aw)
+type AsyncWriter struct {
+	writer  io.Writer
+	queue   chan asyncMessage
+	done    chan struct{}
+	dropped uint64
+	mutex   sync.RWMutex
+	closed  bool
+}
+
+type asyncMessage struct {
+	data    []byte
+	flushed chan struct{}
+}
+
+// NewAsyncWriter starts writing to a writer in the background, queueing up
+// to size messages.
+func NewAsyncWriter(writer io.Writer, size int) *AsyncWriter {
+	if size < 1 {
+		size = 1
+	}
+	aw := &AsyncWriter{
+		writer: writer,
+		queue:  make(chan asyncMessage, size),
+		done:   make(chan struct{}),
+	}
+	go aw.run()
+	return aw
+}
+
+// Write queues a message, or drops it if the queue is full.
+//
+// Dropped messages are not errors; they are counted by Dropped.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a.closed {
+		return 0, ErrClosed
+	}
+
+	msg := asyncMessage{data: make([]byte, len(p))}
+	copy(msg.data, p)
+	select {
+	case a.queue <- msg:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Flush waits until every message queued so far has been written.
+func (a *AsyncWriter) Flush() error {
+	a.mutex.RLock()
+	if a.closed {
+		a.mutex.RUnlock()
+		return nil
+	}
+	flushed := make(chan struct{})
+	a.queue <- asyncMessage{flushed: flushed}
+	a.mutex.RUnlock()
+
+	<-flushed
+	return nil
+}
+
+// Close writes any queued messages and stops the background goroutine.
+//
+// The underlying writer is not closed.
+func (a *AsyncWriter) Close() error {
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mutex.Unlock()
+
+	<-a.done
+	return nil
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for msg := range a.queue {
+		if msg.flushed != nil {
+			close(msg.flushed)
+			continue
+		}
+		if _, err := a.writer.Write(msg.data); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in asynchronous log writer: %s\n", err)
+		}
+	}
+}
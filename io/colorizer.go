@@ -2,6 +2,8 @@ package io
 
 import (
 	cio "io"
+	"os"
+	"regexp"
 	"strings"
 )
 
@@ -10,7 +12,10 @@ import (
 // This can be used to colorize logs as they pass through to another writer. The
 // colorization uses the UNIX-style shell color coding.
 //
-// TODO: This is a very basic implementation, and could use some TLC.
+// Each line is colored by its level, which is read from the start of the line.
+// It understands the labels written by the log package (like "[critical] "),
+// Context.Log prefixes (like "warn" or "error"), and logfmt level fields
+// ("level=info"). Route and command names are highlighted within the line.
 //
 // Example Usage:
 //
@@ -29,30 +34,87 @@ import (
 //
 // Given the above, log messages will be colorized before written
 // to `io.Stdout`.
+//
+// NewColorizer turns colors off when the NO_COLOR environment variable is set,
+// or when the writer is a file that is not a terminal (say, when output is
+// redirected). Set Enabled to override that.
 type Colorizer struct {
+	// Theme holds the colors to use.
+	Theme Theme
+	// Enabled turns colorizing on or off. When off, lines are passed through
+	// unchanged.
+	Enabled bool
+
 	writer cio.Writer
 }
 
+// Theme is a set of colors for a Colorizer.
+//
+// Each color is an ANSI SGR parameter string, like "0;31" for red or "1" for
+// bold. An empty color leaves that text alone.
+type Theme struct {
+	Emergency, Alert, Critical, Error, Warning, Notice, Info, Debug string
+
+	// Highlight is used for route and command names.
+	Highlight string
+}
+
+// DefaultTheme colors every level, and bolds route and command names.
+var DefaultTheme = Theme{
+	Emergency: "1;37;41",
+	Alert:     "1;31",
+	Critical:  "1;31",
+	Error:     "0;31",
+	Warning:   "0;33",
+	Notice:    "0;32",
+	Info:      "0;36",
+	Debug:     "0;90",
+	Highlight: "1",
+}
+
+// QuietTheme colors only errors and warnings.
+var QuietTheme = Theme{
+	Emergency: "1;31",
+	Alert:     "1;31",
+	Critical:  "1;31",
+	Error:     "0;31",
+	Warning:   "0;33",
+}
+
 // NewColorizer creates a new colorizer that wraps a given io.Writer.
 func NewColorizer(writer cio.Writer) *Colorizer {
 	c := new(Colorizer)
 	c.writer = writer
+	c.Theme = DefaultTheme
+	c.Enabled = ColorSupported(writer)
 
 	return c
 }
 
+// ColorSupported guesses whether colors should be written to a writer.
+//
+// It returns false if NO_COLOR is set to anything but an empty string, or if
+// the writer is an *os.File that is not a terminal. Other writers are assumed
+// to want colors.
+func ColorSupported(writer cio.Writer) bool {
+	if len(os.Getenv("NO_COLOR")) > 0 {
+		return false
+	}
+	if f, ok := writer.(*os.File); ok {
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+	return true
+}
+
 // Write colorizes a message and then passes it to the underlying writer.
 func (r *Colorizer) Write(data []byte) (int, error) {
-
-	str := string(data)
-	if strings.HasPrefix(str, "error") {
-		str = "\033[0;31m" + str + "\033[m"
-	} else if strings.HasPrefix(str, "warn") {
-		str = "\033[0;33m" + str + "\033[m"
-	} else if strings.HasPrefix(str, "info") {
-		str = "\033[0;36m" + str + "\033[m"
+	if !r.Enabled {
+		return r.writer.Write(data)
 	}
 
+	str := r.colorize(string(data))
+
 	wlen, err := r.writer.Write([]byte(str))
 
 	dlen := len(data)
@@ -65,3 +127,86 @@ func (r *Colorizer) Write(data []byte) (int, error) {
 	return dlen, err
 
 }
+
+// highlightRe matches route and command names, as in "route=/foo",
+// "command=auth", or "on route '/foo'".
+var highlightRe = regexp.MustCompile(`\b(route|command)(=|\s+'?)("[^"]*"|[^\s',:]+)`)
+
+func (r *Colorizer) colorize(str string) string {
+	color := r.Theme.color(lineLevel(str))
+
+	if len(r.Theme.Highlight) > 0 {
+		// After a highlight, go back to the line's color.
+		restore := "\033[m"
+		if len(color) > 0 {
+			restore += "\033[" + color + "m"
+		}
+		str = highlightRe.ReplaceAllString(str, "$1$2\033["+r.Theme.Highlight+"m$3"+restore)
+	}
+	if len(color) == 0 {
+		return str
+	}
+
+	// Reset the color before the newline, so it does not bleed into the next
+	// line.
+	body := strings.TrimRight(str, "\n")
+	return "\033[" + color + "m" + body + "\033[m" + str[len(body):]
+}
+
+func (t Theme) color(level string) string {
+	switch level {
+	case "emergency":
+		return t.Emergency
+	case "alert":
+		return t.Alert
+	case "critical":
+		return t.Critical
+	case "error":
+		return t.Error
+	case "warning":
+		return t.Warning
+	case "notice":
+		return t.Notice
+	case "info":
+		return t.Info
+	case "debug":
+		return t.Debug
+	}
+	return ""
+}
+
+// levelAliases maps the level names used in log lines to their full names.
+var levelAliases = map[string]string{
+	"emergency": "emergency",
+	"emerg":     "emergency",
+	"alert":     "alert",
+	"critical":  "critical",
+	"crit":      "critical",
+	"error":     "error",
+	"err":       "error",
+	"warning":   "warning",
+	"warn":      "warning",
+	"notice":    "notice",
+	"info":      "info",
+	"debug":     "debug",
+}
+
+// lineLevel finds the name of the level at the start of a line.
+func lineLevel(str string) string {
+	switch {
+	case strings.HasPrefix(str, "["):
+		if end := strings.IndexByte(str, ']'); end > 0 {
+			str = str[1:end]
+		}
+	case strings.HasPrefix(str, "level="):
+		str = str[len("level="):]
+	}
+
+	end := strings.IndexFunc(str, func(r rune) bool {
+		return r < 'a' || r > 'z'
+	})
+	if end >= 0 {
+		str = str[:end]
+	}
+	return levelAliases[str]
+}
@@ -2,6 +2,8 @@ package io
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
 	"testing"
 )
 
@@ -36,3 +38,63 @@ func TestColorizer(t *testing.T) {
 	}
 
 }
+
+func TestColorizerLevels(t *testing.T) {
+	tests := map[string]string{
+		"[critical] 2015/06/16 Down\n": "\033[1;31m[critical] 2015/06/16 Down\033[m\n",
+		"[debug] Details":              "\033[0;90m[debug] Details\033[m",
+		"warning 12:00:00 Careful":     "\033[0;33mwarning 12:00:00 Careful\033[m",
+		"level=notice msg=Started":     "\033[0;32mlevel=notice msg=Started\033[m",
+		"2015/06/16 No level":          "2015/06/16 No level",
+	}
+	for in, expect := range tests {
+		buffer := new(bytes.Buffer)
+		colorizer := NewColorizer(buffer)
+		colorizer.Enabled = true
+		colorizer.Write([]byte(in))
+		if buffer.String() != expect {
+			t.Errorf("! Expected %q to be colored as %q, got %q", in, expect, buffer.String())
+		}
+	}
+}
+
+func TestColorizerHighlight(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	colorizer := NewColorizer(buffer)
+	colorizer.Enabled = true
+	colorizer.Write([]byte("[error] Fatal Error on route '/user': boom"))
+
+	expect := "\033[0;31m[error] Fatal Error on route '\033[1m/user\033[m\033[0;31m': boom\033[m"
+	if buffer.String() != expect {
+		t.Errorf("! Expected the route to be highlighted, got %q", buffer.String())
+	}
+
+	buffer.Reset()
+	colorizer.Theme = QuietTheme
+	colorizer.Write([]byte("level=info msg=hi route=/user command=auth"))
+	if buffer.String() != "level=info msg=hi route=/user command=auth" {
+		t.Errorf("! Expected the quiet theme to leave info alone, got %q", buffer.String())
+	}
+}
+
+func TestColorizerDisabled(t *testing.T) {
+	f, err := ioutil.TempFile("", "cookoo-color")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if NewColorizer(f).Enabled {
+		t.Error("! Expected colors to be off for a plain file.")
+	}
+
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	buffer := new(bytes.Buffer)
+	colorizer := NewColorizer(buffer)
+	colorizer.Write([]byte("error test"))
+	if buffer.String() != "error test" {
+		t.Errorf("! Expected NO_COLOR to turn colors off, got %q", buffer.String())
+	}
+}
@@ -4,6 +4,21 @@ import (
 	"io"
 	"os"
 	"fmt"
+	"sync"
+)
+
+// WritePolicy says what a MultiWriter does when one of its writers fails.
+type WritePolicy int
+
+const (
+	// BestEffort writes to every writer, even after one fails. The last error
+	// is returned. This is the default.
+	BestEffort WritePolicy = iota
+	// FailFast stops at the first writer that fails, and returns its error.
+	FailFast
+	// DropFailing removes a writer as soon as it fails, and keeps writing to
+	// the others.
+	DropFailing
 )
 
 // MultiWriter enables you to have a writer that passes on the writing to one
@@ -13,25 +28,55 @@ import (
 // operations. To do this you will need to mock the type. For example,
 // mw := NewMultiWriter()
 // mw.(*MultiWriter).AddWriter("foo", foo)
+//
+// Writers are written to in the order they were added. A MultiWriter is safe
+// to use from many goroutines, and writers may be added or removed while it
+// is in use.
+//
+// A slow writer holds up every write. To keep one from stalling the others,
+// add it with AddAsyncWriter.
 type MultiWriter struct {
+	mutex   sync.RWMutex
 	writers map[string]io.Writer
+	// list is replaced, never changed, so Write can use it without a lock.
+	list   []namedWriter
+	policy WritePolicy
+}
+
+type namedWriter struct {
+	name   string
+	writer io.Writer
 }
 
 // Write sends the bytes to each of the attached writers to be written.
+//
+// What happens when a writer fails depends on the WritePolicy.
 func (t *MultiWriter) Write(p []byte) (n int, err error) {
-	for name, w := range t.writers {
-		n, err = w.Write(p)
-		if err != nil {
+	t.mutex.RLock()
+	list, policy := t.list, t.policy
+	t.mutex.RUnlock()
+
+	for _, nw := range list {
+		wn, werr := nw.writer.Write(p)
+		if werr != nil {
 			// One broken logger should not stop the others.
-			fmt.Fprintf(os.Stderr, "Error logging to '%s': %s", name, err)
-			continue
-		}
-		if n < len(p) {
+			fmt.Fprintf(os.Stderr, "Error logging to '%s': %s", nw.name, werr)
+		} else if wn < len(p) {
 			// One broken logger should not stop the others.
-			err = io.ErrShortWrite
-			fmt.Fprintf(os.Stderr, "Short write logging to '%s': Expected to write %d (%V), wrote %d", name, len(p), w, n)
+			werr = io.ErrShortWrite
+			fmt.Fprintf(os.Stderr, "Short write logging to '%s': Expected to write %d (%v), wrote %d", nw.name, len(p), nw.writer, wn)
+		} else {
 			continue
 		}
+		err = werr
+
+		switch policy {
+		case FailFast:
+			return wn, err
+		case DropFailing:
+			t.removeWriter(nw.name, nw.writer)
+			fmt.Fprintf(os.Stderr, "Removed logger '%s' after it failed.\n", nw.name)
+		}
 	}
 	return len(p), err
 }
@@ -39,30 +84,176 @@ func (t *MultiWriter) Write(p []byte) (n int, err error) {
 // Init initializes the MultiWriter.
 func (t *MultiWriter) Init() *MultiWriter {
 	t.writers = make(map[string]io.Writer)
+	t.list = nil
 	return t
 }
 
+// Policy returns the policy for failed writes.
+func (t *MultiWriter) Policy() WritePolicy {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.policy
+}
+
+// SetPolicy sets the policy for failed writes.
+func (t *MultiWriter) SetPolicy(policy WritePolicy) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.policy = policy
+}
+
 // Writer retrieves a given io.Writer given its name.
 func (t *MultiWriter) Writer(name string) (io.Writer, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
 	value, found := t.writers[name]
 	return value, found
 }
 
 // Writers retrieves a map of all io.Writers keyed by name.
+//
+// The map is a copy.
 func (t *MultiWriter) Writers() map[string]io.Writer {
-	return t.writers
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	writers := make(map[string]io.Writer, len(t.writers))
+	for name, w := range t.writers {
+		writers[name] = w
+	}
+	return writers
+}
+
+// Len returns the number of writers.
+func (t *MultiWriter) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.list)
+}
+
+// Names returns the names of the writers, in the order they are written to.
+func (t *MultiWriter) Names() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	names := make([]string, len(t.list))
+	for i, nw := range t.list {
+		names[i] = nw.name
+	}
+	return names
 }
 
 // AddWriter adds an io.Writer with an associated name.
+//
+// A writer with the same name is replaced, keeping its place in the order.
 func (t *MultiWriter) AddWriter(name string, writer io.Writer) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	list := make([]namedWriter, 0, len(t.list)+1)
+	replaced := false
+	for _, nw := range t.list {
+		if nw.name == name {
+			nw.writer = writer
+			replaced = true
+		}
+		list = append(list, nw)
+	}
+	if !replaced {
+		list = append(list, namedWriter{name, writer})
+	}
+	t.list = list
 	t.writers[name] = writer
 }
 
+// AddAsyncWriter adds a writer that is written to in the background.
+//
+// Up to size messages are queued for the writer. When the queue is full, new
+// messages are dropped (see Dropped). The returned AsyncWriter can be flushed
+// and closed on its own, or through Flush and Close.
+func (t *MultiWriter) AddAsyncWriter(name string, writer io.Writer, size int) *AsyncWriter {
+	aw := NewAsyncWriter(writer, size)
+	t.AddWriter(name, aw)
+	return aw
+}
+
 // RemoveWriter removes an io.Writer given a name.
 func (t *MultiWriter) RemoveWriter(name string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.remove(name)
+}
+
+// removeWriter removes a writer, but only if it has not been replaced.
+func (t *MultiWriter) removeWriter(name string, writer io.Writer) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if current, ok := t.writers[name]; ok && current == writer {
+		t.remove(name)
+	}
+}
+
+func (t *MultiWriter) remove(name string) {
+	list := make([]namedWriter, 0, len(t.list))
+	for _, nw := range t.list {
+		if nw.name != name {
+			list = append(list, nw)
+		}
+	}
+	t.list = list
 	delete(t.writers, name)
 }
 
+// Flusher is a writer that can flush buffered writes.
+type Flusher interface {
+	Flush() error
+}
+
+// Flush flushes every writer that is a Flusher, such as an AsyncWriter.
+//
+// The first error is returned.
+func (t *MultiWriter) Flush() error {
+	var err error
+	for _, nw := range t.snapshot() {
+		if f, ok := nw.writer.(Flusher); ok {
+			if ferr := f.Flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+	}
+	return err
+}
+
+// Close drains and stops every AsyncWriter.
+//
+// Other writers are left open, since they are often shared (like os.Stdout).
+func (t *MultiWriter) Close() error {
+	var err error
+	for _, nw := range t.snapshot() {
+		if aw, ok := nw.writer.(*AsyncWriter); ok {
+			if cerr := aw.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// Dropped returns the number of messages dropped by each AsyncWriter.
+func (t *MultiWriter) Dropped() map[string]uint64 {
+	dropped := map[string]uint64{}
+	for _, nw := range t.snapshot() {
+		if aw, ok := nw.writer.(*AsyncWriter); ok {
+			dropped[nw.name] = aw.Dropped()
+		}
+	}
+	return dropped
+}
+
+func (t *MultiWriter) snapshot() []namedWriter {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.list
+}
+
 // NewMultiWriter returns an initialized MultiWriter.
 func NewMultiWriter() io.Writer {
 	w := new(MultiWriter).Init()
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -100,3 +101,127 @@ func TestMultiWriterErrors(t *testing.T) {
 		t.Error("! Error was expected and did now occur.")
 	}
 }
+
+// recorder is a writer that records what it was sent.
+type recorder struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lines = append(r.lines, string(p))
+	return len(p), nil
+}
+
+func (r *recorder) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.lines)
+}
+
+func TestMultiWriterPolicies(t *testing.T) {
+	mw := NewMultiWriter().(*MultiWriter)
+	first, last := new(recorder), new(recorder)
+	mw.AddWriter("first", first)
+	mw.AddWriter("broken", new(fakewriter1))
+	mw.AddWriter("last", last)
+
+	if names := mw.Names(); strings.Join(names, ",") != "first,broken,last" {
+		t.Errorf("! Expected writers in the order added, got %v", names)
+	}
+
+	// BestEffort is the default.
+	if _, err := mw.Write([]byte("a")); err == nil || last.Len() != 1 {
+		t.Error("! Expected an error, and the last writer to be written to.")
+	}
+
+	mw.SetPolicy(FailFast)
+	if _, err := mw.Write([]byte("b")); err == nil || last.Len() != 1 || first.Len() != 2 {
+		t.Error("! Expected writing to stop at the broken writer.")
+	}
+
+	mw.SetPolicy(DropFailing)
+	mw.Write([]byte("c"))
+	if _, ok := mw.Writer("broken"); ok {
+		t.Error("! Expected the broken writer to be removed.")
+	}
+	if _, err := mw.Write([]byte("d")); err != nil || last.Len() != 3 {
+		t.Errorf("! Expected the remaining writers to work, got %v", err)
+	}
+}
+
+// slowWriter blocks until it is released.
+type slowWriter struct {
+	recorder
+	release chan struct{}
+}
+
+func (s *slowWriter) Write(p []byte) (int, error) {
+	<-s.release
+	return s.recorder.Write(p)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	mw := NewMultiWriter().(*MultiWriter)
+	fast := new(recorder)
+	slow := &slowWriter{release: make(chan struct{})}
+	mw.AddWriter("fast", fast)
+	mw.AddAsyncWriter("slow", slow, 2)
+
+	// The slow writer holds the first message, and queues two more.
+	for i := 0; i < 10; i++ {
+		if _, err := fmt.Fprintf(mw, "line %d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fast.Len() != 10 {
+		t.Errorf("! Expected the fast writer not to wait, got %d lines", fast.Len())
+	}
+	dropped := mw.Dropped()["slow"]
+	if dropped < 7 || dropped > 8 {
+		t.Errorf("! Expected 7 or 8 dropped messages, got %d", dropped)
+	}
+
+	close(slow.release)
+	if err := mw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := slow.Len(); uint64(n)+dropped != 10 {
+		t.Errorf("! Expected %d lines after a flush, got %d", 10-dropped, n)
+	}
+
+	mw.Write([]byte("last\n"))
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if slow.lines[len(slow.lines)-1] != "last\n" {
+		t.Errorf("! Expected Close to drain the queue, got %v", slow.lines)
+	}
+	if _, err := mw.Write([]byte("closed\n")); err == nil {
+		t.Error("! Expected an error writing to a closed writer.")
+	}
+}
+
+func TestMultiWriterConcurrent(t *testing.T) {
+	mw := NewMultiWriter().(*MultiWriter)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("w%d", i)
+			mw.AddWriter(name, new(recorder))
+			mw.RemoveWriter(name)
+		}(i)
+		go func() {
+			defer wg.Done()
+			mw.Write([]byte("x"))
+		}()
+	}
+	wg.Wait()
+	if len(mw.Names()) != 0 {
+		t.Errorf("! Expected no writers, got %v", mw.Names())
+	}
+}
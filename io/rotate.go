@@ -0,0 +1,296 @@
+package io
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RotatingFile is a log file that rotates itself.
+//
+// When the file grows past MaxSize, or gets older than MaxAge, it is moved
+// aside and a new file is started. The old file becomes a backup, named
+// Filename.1 (or Filename.1.gz when Compress is set). Older backups are
+// shifted up to Filename.2, Filename.3, and so on, and any beyond MaxBackups
+// are removed.
+//
+// Backups are compressed in the background, so writes do not wait for them.
+// If compressing fails, the error is printed to stderr and the backup is kept
+// as it is, uncompressed.
+//
+// A RotatingFile is safe for concurrent writes, so it can be given straight to
+// Context.AddLogger or MultiWriter.AddWriter:
+//
+//	f := io.NewRotatingFile("/var/log/app.log", 10<<20, 5)
+//	f.ReopenOnSignal()
+//	defer f.Close()
+//	cxt.AddLogger("file", f)
+//
+// The file is opened (and created, along with its directory) on the first
+// write. Set the options before writing.
+type RotatingFile struct {
+	// Filename is the path to the log file.
+	Filename string
+	// MaxSize is the size in bytes at which the file is rotated. If 0, the
+	// file is never rotated for its size.
+	MaxSize int64
+	// MaxAge is the age at which the file is rotated, measured from when it
+	// was opened, not from when it was created. A file that already exists
+	// when it is opened, as after a restart, starts its age over. If 0, the
+	// file is never rotated for its age.
+	MaxAge time.Duration
+	// MaxBackups is the number of old files to keep. If 0, old files are
+	// removed when the file is rotated.
+	MaxBackups int
+	// Compress gzips the old files.
+	Compress bool
+
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64
+	opened  time.Time
+	signals chan os.Signal
+	now     func() time.Time
+	// compressing tracks the backup being compressed, if any.
+	compressing sync.WaitGroup
+}
+
+// NewRotatingFile creates a RotatingFile that rotates at maxSize bytes and
+// keeps maxBackups compressed backups.
+func NewRotatingFile(filename string, maxSize int64, maxBackups int) *RotatingFile {
+	return &RotatingFile{
+		Filename:   filename,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		Compress:   true,
+	}
+}
+
+// Write writes to the file, rotating it first if needed.
+//
+// A single write is never split across files, so a write larger than MaxSize
+// goes into a file of its own.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size > 0 && r.MaxSize > 0 && r.size+int64(len(p)) > r.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	} else if r.MaxAge > 0 && r.clock().Sub(r.opened) >= r.MaxAge {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file now, whatever its size or age.
+func (r *RotatingFile) Rotate() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	return r.rotate()
+}
+
+// Reopen closes the file and opens it again.
+//
+// Use this when another tool (like logrotate) has moved the file aside. The
+// next write goes to a new file at Filename.
+func (r *RotatingFile) Reopen() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.close(); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// ReopenOnSignal calls Reopen whenever the process receives one of the given
+// signals. With no signals, SIGHUP is used.
+//
+// This stops when the file is closed.
+func (r *RotatingFile) ReopenOnSignal(sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.signals != nil {
+		signal.Notify(r.signals, sig...)
+		return
+	}
+	r.signals = make(chan os.Signal, 1)
+	signal.Notify(r.signals, sig...)
+	go func(c chan os.Signal) {
+		for range c {
+			r.mutex.Lock()
+			var err error
+			// Skip signals that arrive as the file is being closed.
+			if r.signals == c {
+				if err = r.close(); err == nil {
+					err = r.open()
+				}
+			}
+			r.mutex.Unlock()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reopening log file '%s': %s\n", r.Filename, err)
+			}
+		}
+	}(r.signals)
+}
+
+// Close closes the file and stops listening for signals. It waits for a
+// backup that is being compressed.
+//
+// Writing after Close opens the file again.
+func (r *RotatingFile) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.compressing.Wait()
+	if r.signals != nil {
+		signal.Stop(r.signals)
+		close(r.signals)
+		r.signals = nil
+	}
+	return r.close()
+}
+
+func (r *RotatingFile) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.Filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	r.opened = r.clock()
+	return nil
+}
+
+func (r *RotatingFile) close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// rotate moves the current file to the first backup and opens a new one.
+// The caller must hold the lock.
+func (r *RotatingFile) rotate() error {
+	if err := r.close(); err != nil {
+		return err
+	}
+
+	if r.MaxBackups <= 0 {
+		if err := os.Remove(r.Filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+
+	// The last backup must be done before it is shifted. This only waits if
+	// the file is rotated again before it is compressed.
+	r.compressing.Wait()
+
+	// Drop the oldest backup and shift the others up. A backup that could not
+	// be compressed is shifted along with the rest, so it is not lost.
+	for _, ext := range []string{"", ".gz"} {
+		os.Remove(r.backupName(r.MaxBackups) + ext)
+		for i := r.MaxBackups - 1; i > 0; i-- {
+			err := os.Rename(r.backupName(i)+ext, r.backupName(i+1)+ext)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	first := r.backupName(1)
+	if err := os.Rename(r.Filename, first); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.Compress {
+		r.compressing.Add(1)
+		go func() {
+			defer r.compressing.Done()
+			if err := compressFile(first, first+".gz"); err != nil {
+				fmt.Fprintf(os.Stderr, "Error compressing log file '%s': %s\n", first, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// backupName returns the name of a backup, before it is compressed.
+func (r *RotatingFile) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", r.Filename, i)
+}
+
+// compressFile gzips src into dest, then removes src.
+func compressFile(src, dest string) error {
+	in, err := os.Open(src)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,209 @@
+package io
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func tempLogDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cookoo-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readGzip(t *testing.T, filename string) string {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "logs", "app.log")
+
+	r := NewRotatingFile(name, 12, 2)
+	defer r.Close()
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// one+two, three+four, five. The oldest file is dropped.
+	r.compressing.Wait()
+	data, _ := ioutil.ReadFile(name)
+	if string(data) != "five\n" {
+		t.Errorf("! Expected the current file to hold 'five', got %q", data)
+	}
+	if s := readGzip(t, name+".1.gz"); s != "three\nfour\n" {
+		t.Errorf("! Expected the first backup to hold three and four, got %q", s)
+	}
+	if s := readGzip(t, name+".2.gz"); s != "one\ntwo\n" {
+		t.Errorf("! Expected the second backup to hold one and two, got %q", s)
+	}
+
+	r.Write([]byte("six and more\n"))
+	r.compressing.Wait()
+	if _, err := os.Stat(name + ".3.gz"); !os.IsNotExist(err) {
+		t.Error("! Expected no more than 2 backups.")
+	}
+	if _, err := os.Stat(name + ".1"); !os.IsNotExist(err) {
+		t.Error("! Expected the uncompressed backup to be removed.")
+	}
+}
+
+func TestRotatingFileCompressFails(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+
+	r := NewRotatingFile(name, 5, 1)
+	defer r.Close()
+
+	// A directory in the way keeps the first backup from being compressed.
+	// It is not empty, so rotating cannot remove it, and with one backup
+	// there is nothing to shift it to.
+	os.MkdirAll(filepath.Join(name+".1.gz", "blocker"), 0755)
+	r.Write([]byte("one\n"))
+	r.Write([]byte("two\n"))
+	r.compressing.Wait()
+	if data, _ := ioutil.ReadFile(name + ".1"); string(data) != "one\n" {
+		t.Fatalf("! Expected the backup to be kept uncompressed, got %q", data)
+	}
+
+	// The next rotation shifts it instead of writing over it.
+	os.RemoveAll(name + ".1.gz")
+	r.MaxBackups = 3
+	r.Write([]byte("three\n"))
+	r.compressing.Wait()
+	if data, _ := ioutil.ReadFile(name + ".2"); string(data) != "one\n" {
+		t.Errorf("! Expected the uncompressed backup to be shifted, got %q", data)
+	}
+	if s := readGzip(t, name+".1.gz"); s != "two\n" {
+		t.Errorf("! Expected the new backup to be compressed, got %q", s)
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+
+	now := time.Date(2015, 6, 16, 12, 0, 0, 0, time.UTC)
+	r := &RotatingFile{Filename: name, MaxAge: time.Hour, MaxBackups: 1}
+	r.now = func() time.Time { return now }
+	defer r.Close()
+
+	r.Write([]byte("old\n"))
+	now = now.Add(59 * time.Minute)
+	r.Write([]byte("still old\n"))
+	now = now.Add(time.Minute)
+	r.Write([]byte("new\n"))
+
+	if data, _ := ioutil.ReadFile(name + ".1"); string(data) != "old\nstill old\n" {
+		t.Errorf("! Expected an uncompressed backup of the old file, got %q", data)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "new\n" {
+		t.Errorf("! Expected a new file, got %q", data)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+
+	r := &RotatingFile{Filename: name}
+	r.ReopenOnSignal(syscall.SIGHUP)
+	defer r.Close()
+	r.Write([]byte("before\n"))
+
+	// Something else moves the file aside.
+	if err := os.Rename(name, name+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("Cannot send SIGHUP: %s", err)
+	}
+
+	// Wait for the signal to be handled.
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(name); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.Write([]byte("after\n"))
+
+	if data, _ := ioutil.ReadFile(name); string(data) != "after\n" {
+		t.Errorf("! Expected the file to be reopened, got %q", data)
+	}
+	if data, _ := ioutil.ReadFile(name + ".moved"); string(data) != "before\n" {
+		t.Errorf("! Expected the moved file to be untouched, got %q", data)
+	}
+}
+
+func TestRotatingFileConcurrent(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+
+	r := NewRotatingFile(name, 512, 100)
+	r.Compress = false
+	defer r.Close()
+
+	mw := NewMultiWriter()
+	mw.(*MultiWriter).AddWriter("file", r)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				fmt.Fprintf(mw, "writer %d line %d\n", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	r.Close()
+
+	// Every line must be whole, and none may be lost.
+	files, _ := filepath.Glob(name + "*")
+	lines := 0
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(f)
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if !strings.HasPrefix(line, "writer ") {
+				t.Errorf("! Found a broken line in %s: %q", f, line)
+			}
+			lines++
+		}
+	}
+	if lines != 200 {
+		t.Errorf("! Expected 200 lines, got %d in %d files", lines, len(files))
+	}
+}
@@ -0,0 +1,129 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonParser reads JSON into nodes, keeping track of line numbers.
+type jsonParser struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// parseJSON parses a JSON document.
+func parseJSON(data []byte) (*node, error) {
+	p := &jsonParser{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	p.dec.UseNumber()
+
+	n, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.dec.Token(); err != io.EOF {
+		return nil, &Error{Line: p.line(), Message: "unexpected data after the end of the document"}
+	}
+	return n, nil
+}
+
+// line returns the line the decoder has reached.
+func (p *jsonParser) line() int {
+	return lineAt(p.data, p.dec.InputOffset())
+}
+
+// lineAt returns the line number of a byte offset.
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// token reads the next token, converting syntax errors to line-numbered
+// errors.
+func (p *jsonParser) token() (json.Token, error) {
+	tok, err := p.dec.Token()
+	if err == nil {
+		return tok, nil
+	}
+	if serr, ok := err.(*json.SyntaxError); ok {
+		return nil, &Error{Line: lineAt(p.data, serr.Offset), Message: serr.Error()}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, &Error{Line: p.line(), Message: err.Error()}
+}
+
+// value reads one value, and anything inside of it.
+func (p *jsonParser) value() (*node, error) {
+	tok, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+	line := p.line()
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '{' {
+			return p.object(line)
+		}
+		return p.array(line)
+	case json.Number:
+		if i, err := tok.Int64(); err == nil {
+			return &node{kind: scalarNode, line: line, value: int(i)}, nil
+		}
+		f, err := tok.Float64()
+		if err != nil {
+			return nil, &Error{Line: line, Message: fmt.Sprintf("bad number %s", tok)}
+		}
+		return &node{kind: scalarNode, line: line, value: f}, nil
+	}
+	// A string, bool, or nil.
+	return &node{kind: scalarNode, line: line, value: tok}, nil
+}
+
+// object reads the members of an object, after the opening brace.
+func (p *jsonParser) object(line int) (*node, error) {
+	n := newMap(line)
+	for p.dec.More() {
+		tok, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		keyLine := p.line()
+		key := tok.(string)
+
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := n.set(key, keyLine, val); err != nil {
+			return nil, &Error{Line: keyLine, Message: err.Error()}
+		}
+	}
+	// The closing brace.
+	if _, err := p.token(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// array reads the items of an array, after the opening bracket.
+func (p *jsonParser) array(line int) (*node, error) {
+	n := &node{kind: listNode, line: line}
+	for p.dec.More() {
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+	}
+	// The closing bracket.
+	if _, err := p.token(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
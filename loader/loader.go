@@ -0,0 +1,423 @@
+// Package loader reads Cookoo routes from YAML or JSON files.
+//
+// Routes in code are built from Route, Cmd, and the other Tasks. A route file
+// describes the same things, but names each command instead of pointing to a
+// function. The names are registered on a Loader:
+//
+// 	l := loader.New()
+// 	l.Register("web.Flush", web.Flush)
+// 	l.RegisterDef("user.Load", &LoadUser{})
+//
+// 	reg, router, cxt := cookoo.Cookoo()
+// 	if err := l.LoadFile(reg, "routes.yaml"); err != nil {
+// 		// err lists each problem with its line number, like:
+// 		// routes.yaml:12: unknown command 'web.Flsh'
+// 		panic(err)
+// 	}
+//
+// A route file looks like this:
+//
+// 	routes:
+// 	  - name: "@boot"
+// 	    does:
+// 	      - cmd: config.Load
+// 	        name: config
+// 	  - name: GET /user
+// 	    help: Show a user.
+// 	    onError: GET /error
+// 	    does:
+// 	      - include: "@boot"
+// 	      - cmd: user.Load
+// 	        name: user
+// 	        using:
+// 	          - name: id
+// 	            from: query:id
+// 	          - name: verbose
+// 	            type: bool
+// 	            default: false
+// 	        catch: GET /nouser
+// 	      - cmd: web.Flush
+// 	        name: out
+// 	        using:
+// 	          - name: content
+// 	            from: [cxt:user, cxt:config]
+//
+// The same thing in JSON uses the same keys.
+//
+// Each route has a name, and may have help, onError, and does. Each task in
+// does is one of the following:
+//
+// 	- A command: cmd (the registered name), name (defaults to cmd), using,
+// 	  and catch. Each param in using has a name, and may have a type (see
+// 	  cookoo.ParamTypes), a default, and a from. from may be a string or a
+// 	  list of strings.
+// 	- An include: include (the route to include).
+// 	- A parallel group: parallel (the group's name), policy (failOnFatal,
+// 	  failOnAny, or continueOnError), catch, and does.
+// 	- A condition: when or unless (the name of a context value), and does.
+// 	- A loop: forEach (the name of a context value), and does.
+//
+// The YAML reader understands block mappings and sequences, plain and quoted
+// scalars, flow sequences of scalars, and comments. Anchors, aliases, tags,
+// block scalars, and flow mappings are not supported.
+package loader
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/cookoo"
+)
+
+// Error is a problem found while loading routes.
+type Error struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// Error formats the error as FILE:LINE: MESSAGE.
+func (e *Error) Error() string {
+	if len(e.File) == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// Errors are all of the problems found in a file.
+type Errors []*Error
+
+// Error returns one error per line.
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Loader reads routes from files, looking up commands by name.
+type Loader struct {
+	commands map[string]cookoo.Command
+	defs     map[string]cookoo.CommandDefinition
+}
+
+// New creates a Loader with no commands registered.
+func New() *Loader {
+	return &Loader{
+		commands: map[string]cookoo.Command{},
+		defs:     map[string]cookoo.CommandDefinition{},
+	}
+}
+
+// Register makes a command available to route files under a name.
+//
+// Registering a name again replaces the earlier command.
+func (l *Loader) Register(name string, cmd cookoo.Command) *Loader {
+	delete(l.defs, name)
+	l.commands[name] = cmd
+	return l
+}
+
+// RegisterDef makes a CommandDefinition available to route files under a
+// name.
+//
+// The definition is used as a template, as with cookoo.CmdDef: each time the
+// command runs, a new copy is filled in from its params.
+func (l *Loader) RegisterDef(name string, def cookoo.CommandDefinition) *Loader {
+	delete(l.commands, name)
+	l.defs[name] = def
+	return l
+}
+
+// Names returns the registered command names, sorted.
+func (l *Loader) Names() []string {
+	names := make([]string, 0, len(l.commands)+len(l.defs))
+	for name := range l.commands {
+		names = append(names, name)
+	}
+	for name := range l.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadFile reads routes from a file into the registry.
+//
+// Files ending in .json are read as JSON. Everything else is read as YAML.
+func (l *Loader) LoadFile(reg *cookoo.Registry, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		return l.load(reg, filename, data, parseJSON)
+	}
+	return l.load(reg, filename, data, parseYAML)
+}
+
+// LoadJSON reads JSON routes into the registry.
+//
+// The name is used in error messages.
+func (l *Loader) LoadJSON(reg *cookoo.Registry, name string, in io.Reader) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	return l.load(reg, name, data, parseJSON)
+}
+
+// LoadYAML reads YAML routes into the registry.
+//
+// The name is used in error messages.
+func (l *Loader) LoadYAML(reg *cookoo.Registry, name string, in io.Reader) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	return l.load(reg, name, data, parseYAML)
+}
+
+// load parses a document and adds its routes.
+//
+// No routes are added unless the whole file is free of errors.
+func (l *Loader) load(reg *cookoo.Registry, name string, data []byte, parse func([]byte) (*node, error)) error {
+	doc, err := parse(data)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.File = name
+		}
+		return err
+	}
+
+	b := &builder{loader: l, reg: reg, file: name, routes: map[string]bool{}}
+	routes := b.document(doc)
+	if len(b.errs) > 0 {
+		return b.errs
+	}
+	return reg.AddRoutes(routes...)
+}
+
+// builder turns nodes into routes, collecting errors as it goes.
+type builder struct {
+	loader *Loader
+	reg    *cookoo.Registry
+	file   string
+	errs   Errors
+	// routes are the routes declared so far in the file.
+	routes map[string]bool
+}
+
+func (b *builder) errorf(line int, format string, v ...interface{}) {
+	b.errs = append(b.errs, &Error{File: b.file, Line: line, Message: fmt.Sprintf(format, v...)})
+}
+
+// fields checks that a mapping has only the allowed keys.
+func (b *builder) fields(n *node, what string, allowed ...string) bool {
+	if n.kind != mapNode {
+		b.errorf(n.line, "%s must be a mapping, not %s", what, n.describe())
+		return false
+	}
+	for _, k := range n.keys {
+		ok := false
+		for _, a := range allowed {
+			ok = ok || k == a
+		}
+		if !ok {
+			b.errorf(n.keyLines[k], "unknown key '%s' in %s", k, what)
+		}
+	}
+	return true
+}
+
+// str reads an optional string field.
+func (b *builder) str(n *node, key string) string {
+	f, ok := n.fields[key]
+	if !ok || (f.kind == scalarNode && f.value == nil) {
+		return ""
+	}
+	s, ok := f.str()
+	if !ok {
+		b.errorf(f.line, "%s must be a string, not %s", key, f.describe())
+	}
+	return s
+}
+
+// list reads an optional list field.
+func (b *builder) list(n *node, key string) []*node {
+	f, ok := n.fields[key]
+	if !ok || (f.kind == scalarNode && f.value == nil) {
+		return nil
+	}
+	if f.kind != listNode {
+		b.errorf(f.line, "%s must be a list, not %s", key, f.describe())
+		return nil
+	}
+	return f.items
+}
+
+func (b *builder) document(doc *node) []cookoo.Route {
+	if !b.fields(doc, "the document", "routes") {
+		return nil
+	}
+	items := b.list(doc, "routes")
+	routes := make([]cookoo.Route, 0, len(items))
+	for _, item := range items {
+		if !b.fields(item, "a route", "name", "help", "onError", "does") {
+			continue
+		}
+		route := cookoo.Route{
+			Name:    b.str(item, "name"),
+			Help:    b.str(item, "help"),
+			OnError: b.str(item, "onError"),
+		}
+		if len(route.Name) == 0 {
+			b.errorf(item.line, "route has no name")
+		}
+		route.Does = b.tasks(b.list(item, "does"))
+		routes = append(routes, route)
+		b.routes[route.Name] = true
+	}
+	return routes
+}
+
+// tasks builds the tasks in a does list.
+func (b *builder) tasks(items []*node) cookoo.Tasks {
+	tasks := cookoo.Tasks{}
+	for _, item := range items {
+		if item.kind != mapNode {
+			b.errorf(item.line, "a task must be a mapping, not %s", item.describe())
+			continue
+		}
+		var task cookoo.Task
+		switch {
+		case has(item, "cmd"):
+			task = b.command(item)
+		case has(item, "include"):
+			task = b.include(item)
+		case has(item, "parallel"):
+			task = b.parallel(item)
+		case has(item, "when"), has(item, "unless"), has(item, "forEach"):
+			task = b.control(item)
+		default:
+			b.errorf(item.line, "a task needs one of cmd, include, parallel, when, unless, or forEach")
+		}
+		if task != nil {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+func has(n *node, key string) bool {
+	_, ok := n.fields[key]
+	return ok
+}
+
+// command builds a Cmd or a CmdDef.
+func (b *builder) command(n *node) cookoo.Task {
+	b.fields(n, "a command", "cmd", "name", "using", "catch")
+	cmdName := b.str(n, "cmd")
+	name := b.str(n, "name")
+	if len(name) == 0 {
+		name = cmdName
+	}
+	using := b.params(b.list(n, "using"))
+	catch := b.str(n, "catch")
+
+	if cmd, ok := b.loader.commands[cmdName]; ok {
+		return cookoo.Cmd{Name: name, Fn: cmd, Using: using, Catch: catch}
+	}
+	if def, ok := b.loader.defs[cmdName]; ok {
+		return cookoo.CmdDef{Name: name, Def: def, Using: using, Catch: catch}
+	}
+	b.errorf(n.fields["cmd"].line, "unknown command '%s'", cmdName)
+	return nil
+}
+
+// params builds the params in a using list.
+func (b *builder) params(items []*node) cookoo.Parameters {
+	params := cookoo.Parameters{}
+	for _, item := range items {
+		if !b.fields(item, "a param", "name", "type", "default", "from") {
+			continue
+		}
+		p := cookoo.Param{Name: b.str(item, "name")}
+		if len(p.Name) == 0 {
+			b.errorf(item.line, "param has no name")
+		}
+		if def, ok := item.fields["default"]; ok {
+			p.DefaultValue = def.interfaceValue()
+		}
+		if typ := b.str(item, "type"); len(typ) > 0 {
+			if cookoo.IsParamType(typ) {
+				p.DefaultValue = cookoo.Typed(typ, p.DefaultValue)
+			} else {
+				b.errorf(item.fields["type"].line, "unknown type '%s'", typ)
+			}
+		}
+		if from, ok := item.fields["from"]; ok {
+			sources, ok := from.strings()
+			if !ok {
+				b.errorf(from.line, "from must be a string or a list of strings, not %s", from.describe())
+			}
+			p.From = strings.Join(sources, " ")
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+// include builds an Include, checking that the route exists.
+func (b *builder) include(n *node) cookoo.Task {
+	b.fields(n, "an include", "include")
+	path := b.str(n, "include")
+	if _, ok := b.reg.RouteSpec(path); !ok && !b.routes[path] {
+		b.errorf(n.fields["include"].line, "unknown route '%s'", path)
+		return nil
+	}
+	return cookoo.Include{Path: path}
+}
+
+var policies = map[string]cookoo.ParallelPolicy{
+	"failOnFatal":     cookoo.FailOnFatal,
+	"failOnAny":       cookoo.FailOnAny,
+	"continueOnError": cookoo.ContinueOnError,
+}
+
+// parallel builds a Parallel group.
+func (b *builder) parallel(n *node) cookoo.Task {
+	b.fields(n, "a parallel group", "parallel", "policy", "catch", "does")
+	group := cookoo.Parallel{
+		Name:  b.str(n, "parallel"),
+		Catch: b.str(n, "catch"),
+		Does:  b.tasks(b.list(n, "does")),
+	}
+	if policy := b.str(n, "policy"); len(policy) > 0 {
+		p, ok := policies[policy]
+		if !ok {
+			b.errorf(n.fields["policy"].line, "unknown policy '%s'", policy)
+		}
+		group.Policy = p
+	}
+	return group
+}
+
+// control builds a When, Unless, or ForEach.
+func (b *builder) control(n *node) cookoo.Task {
+	switch {
+	case has(n, "when"):
+		b.fields(n, "a condition", "when", "does")
+		return cookoo.When{Cond: b.str(n, "when"), Does: b.tasks(b.list(n, "does"))}
+	case has(n, "unless"):
+		b.fields(n, "a condition", "unless", "does")
+		return cookoo.Unless{Cond: b.str(n, "unless"), Does: b.tasks(b.list(n, "does"))}
+	}
+	b.fields(n, "a loop", "forEach", "does")
+	return cookoo.ForEach{In: b.str(n, "forEach"), Does: b.tasks(b.list(n, "does"))}
+}
@@ -0,0 +1,214 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/cookoo"
+)
+
+type greet struct {
+	Name string
+}
+
+func (g *greet) Run(c cookoo.Context) (interface{}, cookoo.Interrupt) {
+	return "Hello " + g.Name, nil
+}
+
+func fetch(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	return p, nil
+}
+
+func testLoader() *Loader {
+	return New().
+		Register("fetch", fetch).
+		Register("context.Add", cookoo.AddToContext).
+		RegisterDef("greet", &greet{})
+}
+
+const testYAML = `
+# Routes for the loader test.
+routes:
+  - name: "@boot"
+    does:
+      - cmd: context.Add
+        name: boot
+        using:
+          - name: who
+            default: World
+  - name: test
+    help: A test route.
+    does:
+      - include: "@boot"
+      - cmd: fetch
+        using:
+          - name: a
+            type: int
+            default: "1"
+          - name: b
+            from: [cxt:missing, cxt:who]
+          - name: c
+            default: [x, 'y z']
+      - cmd: greet
+        name: hello
+        using:
+          - name: Name
+            from: cxt:who
+`
+
+const testJSON = `{
+  "routes": [
+    {"name": "@boot", "does": [
+      {"cmd": "context.Add", "name": "boot", "using": [{"name": "who", "default": "World"}]}
+    ]},
+    {"name": "test", "help": "A test route.", "does": [
+      {"include": "@boot"},
+      {"cmd": "fetch", "using": [
+        {"name": "a", "type": "int", "default": "1"},
+        {"name": "b", "from": ["cxt:missing", "cxt:who"]},
+        {"name": "c", "default": ["x", "y z"]}
+      ]},
+      {"cmd": "greet", "name": "hello", "using": [{"name": "Name", "from": "cxt:who"}]}
+    ]}
+  ]
+}`
+
+func TestLoad(t *testing.T) {
+	docs := map[string]func(*Loader, *cookoo.Registry) error{
+		"yaml": func(l *Loader, reg *cookoo.Registry) error {
+			return l.LoadYAML(reg, "test.yaml", strings.NewReader(testYAML))
+		},
+		"json": func(l *Loader, reg *cookoo.Registry) error {
+			return l.LoadJSON(reg, "test.json", strings.NewReader(testJSON))
+		},
+	}
+
+	for format, load := range docs {
+		reg, router, cxt := cookoo.Cookoo()
+		if err := load(testLoader(), reg); err != nil {
+			t.Fatalf("! %s: %s", format, err)
+		}
+
+		if spec, ok := reg.RouteSpec("test"); !ok || spec.Description() != "A test route." {
+			t.Errorf("! %s: expected route 'test' with help", format)
+		}
+		if err := router.HandleRequest("test", cxt, false); err != nil {
+			t.Fatalf("! %s: %s", format, err)
+		}
+
+		p := cxt.Get("fetch", nil).(*cookoo.Params)
+		if p.Get("a", nil) != 1 {
+			t.Errorf("! %s: expected default 1, got %#v", format, p.Get("a", nil))
+		}
+		if p.Get("b", nil) != "World" {
+			t.Errorf("! %s: expected b from cxt:who, got %#v", format, p.Get("b", nil))
+		}
+		if c, ok := p.Get("c", nil).([]interface{}); !ok || len(c) != 2 || c[1] != "y z" {
+			t.Errorf("! %s: expected a list default, got %#v", format, p.Get("c", nil))
+		}
+		if cxt.Get("hello", nil) != "Hello World" {
+			t.Errorf("! %s: expected the CmdDef to run, got %v", format, cxt.Get("hello", nil))
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cookoo-loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, doc := range map[string]string{"routes.yml": testYAML, "routes.json": testJSON} {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+		reg := cookoo.NewRegistry()
+		if err := testLoader().LoadFile(reg, filename); err != nil {
+			t.Errorf("! %s: %s", name, err)
+		}
+		if len(reg.RouteNames()) != 2 {
+			t.Errorf("! %s: expected 2 routes, got %v", name, reg.RouteNames())
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	doc := `routes:
+  - name: test
+    does:
+      - cmd: fetch
+      - cmd: nope
+        using:
+          - name: a
+            form: cxt:a
+            type: number
+      - include: missing
+      - parallel: group
+        policy: sometimes
+        does:
+          - cmd: nope2
+`
+	reg := cookoo.NewRegistry()
+	err := testLoader().LoadYAML(reg, "bad.yaml", strings.NewReader(doc))
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("! Expected Errors, got %v", err)
+	}
+
+	expect := []string{
+		"bad.yaml:5: unknown command 'nope'",
+		"bad.yaml:8: unknown key 'form' in a param",
+		"bad.yaml:9: unknown type 'number'",
+		"bad.yaml:10: unknown route 'missing'",
+		"bad.yaml:14: unknown command 'nope2'",
+		"bad.yaml:12: unknown policy 'sometimes'",
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("! Expected %d errors, got:\n%s", len(expect), errs)
+	}
+	for _, e := range expect {
+		if !strings.Contains(errs.Error(), e) {
+			t.Errorf("! Expected %q in:\n%s", e, errs)
+		}
+	}
+	if len(reg.RouteNames()) != 0 {
+		t.Error("! Expected no routes to be added from a bad file.")
+	}
+
+	// Some problems are only found as the routes are added. Even so, the
+	// routes before them are not added.
+	doc = `routes:
+  - name: cond
+    does:
+      - when: x
+        does:
+          - cmd: fetch
+  - name: test
+    does:
+      - parallel: group
+        does:
+          - include: cond
+`
+	if err := testLoader().LoadYAML(reg, "late.yaml", strings.NewReader(doc)); err == nil {
+		t.Error("! Expected an error for a When in a Parallel group.")
+	}
+	if len(reg.RouteNames()) != 0 {
+		t.Errorf("! Expected no routes to be added, got %v", reg.RouteNames())
+	}
+
+	jsonDoc := "{\"routes\": [\n  {\"name\": \"test\", \"does\": [\n    {\"cmd\": \"nope\"}\n  ]}\n]}"
+	err = testLoader().LoadJSON(reg, "bad.json", strings.NewReader(jsonDoc))
+	if err == nil || err.Error() != "bad.json:3: unknown command 'nope'" {
+		t.Errorf("! Expected a line-numbered JSON error, got %v", err)
+	}
+
+	err = testLoader().LoadJSON(reg, "broken.json", strings.NewReader("{\"routes\": [\n  {\"name\": }\n]}"))
+	if e, ok := err.(*Error); !ok || e.Line != 2 || e.File != "broken.json" {
+		t.Errorf("! Expected a JSON syntax error on line 2, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// kind is the kind of a node.
+type kind int
+
+const (
+	scalarNode kind = iota
+	mapNode
+	listNode
+)
+
+// node is a parsed value, along with the line it started on.
+//
+// Both the JSON and YAML readers produce a tree of nodes, so that routes are
+// built the same way, with the same errors, whatever the format.
+type node struct {
+	kind kind
+	line int
+
+	// value is the value of a scalar: a string, int, float64, bool, or nil.
+	value interface{}
+
+	// keys are a map's keys in the order they appeared.
+	keys   []string
+	fields map[string]*node
+	// keyLines are the lines each key appeared on.
+	keyLines map[string]int
+
+	items []*node
+}
+
+func newMap(line int) *node {
+	return &node{kind: mapNode, line: line, fields: map[string]*node{}, keyLines: map[string]int{}}
+}
+
+// set adds a key to a map node.
+func (n *node) set(key string, line int, val *node) error {
+	if _, ok := n.fields[key]; ok {
+		return fmt.Errorf("duplicate key '%s'", key)
+	}
+	n.keys = append(n.keys, key)
+	n.fields[key] = val
+	n.keyLines[key] = line
+	return nil
+}
+
+// describe names the kind of a node for error messages.
+func (n *node) describe() string {
+	switch n.kind {
+	case mapNode:
+		return "a mapping"
+	case listNode:
+		return "a list"
+	}
+	if n.value == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%T", n.value)
+}
+
+// str returns the value of a string scalar.
+func (n *node) str() (string, bool) {
+	if n.kind != scalarNode {
+		return "", false
+	}
+	s, ok := n.value.(string)
+	return s, ok
+}
+
+// strings returns a string scalar, or a list of string scalars, as a list.
+func (n *node) strings() ([]string, bool) {
+	if s, ok := n.str(); ok {
+		return []string{s}, true
+	}
+	if n.kind != listNode {
+		return nil, false
+	}
+	out := make([]string, len(n.items))
+	for i, item := range n.items {
+		s, ok := item.str()
+		if !ok {
+			return nil, false
+		}
+		out[i] = s
+	}
+	return out, true
+}
+
+// interfaceValue converts a node to plain Go values: scalars, a
+// map[string]interface{}, or an []interface{}.
+func (n *node) interfaceValue() interface{} {
+	switch n.kind {
+	case mapNode:
+		m := make(map[string]interface{}, len(n.keys))
+		for _, k := range n.keys {
+			m[k] = n.fields[k].interfaceValue()
+		}
+		return m
+	case listNode:
+		l := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			l[i] = item.interfaceValue()
+		}
+		return l
+	}
+	return n.value
+}
+
+// String renders a node for debugging.
+func (n *node) String() string {
+	switch n.kind {
+	case mapNode:
+		parts := make([]string, len(n.keys))
+		for i, k := range n.keys {
+			parts[i] = fmt.Sprintf("%s: %s", k, n.fields[k])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case listNode:
+		parts := make([]string, len(n.items))
+		for i, item := range n.items {
+			parts[i] = item.String()
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprintf("%#v", n.value)
+}
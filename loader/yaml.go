@@ -0,0 +1,358 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The YAML reader understands the subset of YAML that route files need:
+//
+// 	- Block mappings and block sequences, nested by indentation.
+// 	- Plain, 'single quoted', and "double quoted" scalars. Plain scalars
+// 	  become nil (null, ~, or nothing), bools (true, false), ints, floats,
+// 	  or strings.
+// 	- Flow sequences of scalars ([a, b, c]), and the empty flow mapping ({}).
+// 	- Comments, and a leading document marker (---).
+//
+// Anchors, aliases, tags, block scalars (| and >), flow mappings, and
+// multiple documents are not supported.
+
+// yamlLine is a line with content, stripped of indentation and comments.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlParser reads YAML into nodes.
+type yamlParser struct {
+	lines []*yamlLine
+	pos   int
+}
+
+// parseYAML parses a YAML document.
+func parseYAML(data []byte) (*node, error) {
+	lines, err := yamlLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, &Error{Line: 1, Message: "the document is empty"}
+	}
+
+	p := &yamlParser{lines: lines}
+	n, err := p.node()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return n, nil
+}
+
+// yamlLines splits a document into lines, dropping blank lines and comments.
+func yamlLines(doc string) ([]*yamlLine, error) {
+	lines := []*yamlLine{}
+	for i, text := range strings.Split(doc, "\n") {
+		num := i + 1
+		text = strings.TrimRight(stripComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if len(trimmed) == 0 || (len(lines) == 0 && trimmed == "---") {
+			continue
+		}
+		if trimmed[0] == '\t' {
+			return nil, &Error{Line: num, Message: "tabs cannot be used for indentation"}
+		}
+		lines = append(lines, &yamlLine{num: num, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	return lines, nil
+}
+
+// stripComment removes a comment from the end of a line.
+//
+// A comment starts with a # at the start of the line, or after a space,
+// that is not inside of a quoted scalar.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		case (c == '\'' || c == '"') && (i == 0 || strings.IndexByte(" \t:-[,", text[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return text
+}
+
+func (p *yamlParser) errorf(format string, v ...interface{}) error {
+	num := 0
+	if p.pos < len(p.lines) {
+		num = p.lines[p.pos].num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return &Error{Line: num, Message: fmt.Sprintf(format, v...)}
+}
+
+// node reads the value that starts at the current line.
+func (p *yamlParser) node() (*node, error) {
+	l := p.lines[p.pos]
+	if isSeqItem(l.text) {
+		return p.seq(l.indent)
+	}
+	if _, _, ok, _ := splitKey(l.text); ok {
+		return p.mapping(l.indent)
+	}
+	p.pos++
+	return scalar(l.text, l.num)
+}
+
+// isSeqItem checks whether a line starts a sequence item.
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// seq reads a block sequence whose items are at the given indentation.
+func (p *yamlParser) seq(indent int) (*node, error) {
+	n := &node{kind: listNode, line: p.lines[p.pos].num}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !isSeqItem(l.text) {
+			break
+		}
+
+		var item *node
+		var err error
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if len(rest) == 0 {
+			// The item starts on the next line, or is empty.
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				item, err = p.node()
+			} else {
+				item = &node{kind: scalarNode, line: l.num}
+			}
+		} else {
+			// The item starts on this line, after the dash. Treat the rest
+			// of the line as if it were indented by itself, so that
+			// "- name: x" and the lines under it form one mapping.
+			l.indent += len(l.text) - len(rest)
+			l.text = rest
+			item, err = p.node()
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+
+		if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+	}
+	return n, nil
+}
+
+// mapping reads a block mapping whose keys are at the given indentation.
+func (p *yamlParser) mapping(indent int) (*node, error) {
+	n := newMap(p.lines[p.pos].num)
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || isSeqItem(l.text) {
+			break
+		}
+		key, rest, ok, err := splitKey(l.text)
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		if !ok {
+			return nil, p.errorf("expected 'key: value', got '%s'", l.text)
+		}
+		p.pos++
+
+		var val *node
+		switch {
+		case len(rest) > 0:
+			val, err = scalar(rest, l.num)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent > indent:
+			val, err = p.node()
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text):
+			// A sequence may sit at the same indentation as its key.
+			val, err = p.seq(indent)
+		default:
+			val = &node{kind: scalarNode, line: l.num}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := n.set(key, l.num, val); err != nil {
+			return nil, &Error{Line: l.num, Message: err.Error()}
+		}
+
+		if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+	}
+	return n, nil
+}
+
+// splitKey splits "key: value" into its key and value.
+//
+// If the text is not a key/value pair, ok is false.
+func splitKey(text string) (key, rest string, ok bool, err error) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false, nil
+		}
+		after := text[end+1:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		k, err := unquote(text[:end+1])
+		if err != nil {
+			return "", "", false, err
+		}
+		return k, strings.TrimSpace(after[1:]), true, nil
+	}
+	if text[0] == '[' || text[0] == '{' {
+		return "", "", false, nil
+	}
+
+	if strings.HasSuffix(text, ":") && !strings.Contains(text, ": ") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true, nil
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		return "", "", false, nil
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), true, nil
+}
+
+// closingQuote finds the quote that closes a quoted scalar.
+func closingQuote(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case text[i] == q && q == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			// An escaped single quote.
+			i++
+		case text[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// unquote reads a quoted scalar.
+func unquote(text string) (string, error) {
+	if text[0] == '\'' {
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+	s, err := strconv.Unquote(text)
+	if err != nil {
+		return "", fmt.Errorf("bad quoted string %s", text)
+	}
+	return s, nil
+}
+
+// scalar reads a scalar, or a flow collection of scalars.
+func scalar(text string, line int) (*node, error) {
+	n := &node{kind: scalarNode, line: line}
+	if len(text) == 0 {
+		return n, nil
+	}
+	switch text[0] {
+	case '"', '\'':
+		if closingQuote(text) != len(text)-1 {
+			return nil, &Error{Line: line, Message: fmt.Sprintf("bad quoted string %s", text)}
+		}
+		s, err := unquote(text)
+		if err != nil {
+			return nil, &Error{Line: line, Message: err.Error()}
+		}
+		n.value = s
+		return n, nil
+	case '[':
+		return flowSeq(text, line)
+	case '{':
+		if strings.TrimSpace(text[1:]) != "}" {
+			return nil, &Error{Line: line, Message: "flow mappings are not supported"}
+		}
+		return newMap(line), nil
+	case '|', '>':
+		return nil, &Error{Line: line, Message: "block scalars are not supported"}
+	case '&', '*', '!':
+		return nil, &Error{Line: line, Message: "anchors, aliases, and tags are not supported"}
+	}
+
+	n.value = plainValue(text)
+	return n, nil
+}
+
+// plainValue converts an unquoted scalar to a Go value.
+func plainValue(text string) interface{} {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if i, err := strconv.Atoi(text); err == nil {
+		return i
+	}
+	if strings.IndexByte("0123456789+-.", text[0]) >= 0 {
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	}
+	return text
+}
+
+// flowSeq reads a flow sequence of scalars, like [a, "b", 3].
+func flowSeq(text string, line int) (*node, error) {
+	n := &node{kind: listNode, line: line}
+	if text[len(text)-1] != ']' {
+		return nil, &Error{Line: line, Message: fmt.Sprintf("unterminated sequence %s", text)}
+	}
+	inner := strings.TrimSpace(text[1 : len(text)-1])
+	for len(inner) > 0 {
+		var item string
+		if inner[0] == '"' || inner[0] == '\'' {
+			end := closingQuote(inner)
+			if end < 0 {
+				return nil, &Error{Line: line, Message: fmt.Sprintf("bad quoted string in %s", text)}
+			}
+			item, inner = inner[:end+1], strings.TrimSpace(inner[end+1:])
+			if len(inner) > 0 && inner[0] != ',' {
+				return nil, &Error{Line: line, Message: fmt.Sprintf("expected ',' in %s", text)}
+			}
+		} else if i := strings.IndexByte(inner, ','); i >= 0 {
+			item, inner = strings.TrimSpace(inner[:i]), inner[i:]
+		} else {
+			item, inner = inner, ""
+		}
+		if strings.IndexAny(item, "[]{}") == 0 {
+			return nil, &Error{Line: line, Message: "nested flow collections are not supported"}
+		}
+		inner = strings.TrimSpace(strings.TrimPrefix(inner, ","))
+
+		val, err := scalar(item, line)
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, val)
+	}
+	return n, nil
+}
@@ -0,0 +1,62 @@
+package loader
+
+import (
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	doc := `---
+a: 1
+b: two   # A comment.
+c:
+  - x
+  - "quoted # not a comment"
+  -
+    nested: true
+d:
+- 'it''s'
+- 2.5
+- ~
+e: [1, "two", three]
+f: {}
+g: http://example.com
+"h i": null
+`
+	n, err := parseYAML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `{a: 1, b: "two", c: ["x", "quoted # not a comment", {nested: true}], d: ["it's", 2.5, <nil>], e: [1, "two", "three"], f: {}, g: "http://example.com", h i: <nil>}`
+	if n.String() != expect {
+		t.Errorf("! Expected\n%s\ngot\n%s", expect, n)
+	}
+	if n.keyLines["c"] != 4 || n.fields["c"].items[2].line != 8 {
+		t.Errorf("! Expected line numbers to be kept, got %d and %d", n.keyLines["c"], n.fields["c"].items[2].line)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		doc  string
+		line int
+	}{
+		{"a: 1\n  b: 2\n", 2},
+		{"a: 1\na: 2\n", 2},
+		{"a:\n  - x\n  y: 1\n", 3},
+		{"a: |\n  text\n", 1},
+		{"a: 'open\n", 1},
+		{"", 1},
+	}
+	for _, tt := range tests {
+		_, err := parseYAML([]byte(tt.doc))
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("! Expected an error for %q, got %v", tt.doc, err)
+			continue
+		}
+		if e.Line != tt.line {
+			t.Errorf("! Expected an error on line %d for %q, got %s", tt.line, tt.doc, e)
+		}
+	}
+}
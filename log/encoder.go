@@ -0,0 +1,177 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names for log levels, as used by the encoders.
+var Name = [8]string{
+	"emergency",
+	"alert",
+	"critical",
+	"error",
+	"warning",
+	"notice",
+	"info",
+	"debug",
+}
+
+// String returns the name of the level, like "warning".
+func (l LogLevel) String() string {
+	if int(l) < len(Name) {
+		return Name[l]
+	}
+	return fmt.Sprintf("level%d", l)
+}
+
+// Field is a key/value pair attached to a log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Record is a single structured log message.
+type Record struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+	Fields  []Field
+}
+
+// Encoder turns a Record into a line of log output.
+//
+// The line does not need to end with a newline.
+type Encoder interface {
+	Encode(r *Record) []byte
+}
+
+// LogfmtEncoder writes records as logfmt, one key=value pair after another:
+//
+// 	level=info time=2015-06-16T12:00:00Z msg="Saved user" route="POST /user" user=12
+//
+// The level always comes first.
+type LogfmtEncoder struct{}
+
+// Encode writes a record as logfmt.
+func (e LogfmtEncoder) Encode(r *Record) []byte {
+	var b bytes.Buffer
+	b.WriteString("level=")
+	b.WriteString(r.Level.String())
+	b.WriteString(" time=")
+	b.WriteString(r.Time.Format(time.RFC3339))
+	b.WriteString(" msg=")
+	b.WriteString(logfmtValue(r.Message))
+	writeLogfmtFields(&b, r.Fields)
+	return b.Bytes()
+}
+
+func writeLogfmtFields(b *bytes.Buffer, fields []Field) {
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(logfmtKey(f.Key))
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(fieldString(f.Value)))
+	}
+}
+
+// logfmtKey removes characters that are not allowed in a key.
+func logfmtKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+// logfmtValue quotes a value if it needs it.
+func logfmtValue(v string) string {
+	if len(v) == 0 || strings.IndexFunc(v, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || r > '~'
+	}) >= 0 {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// fieldString formats a field value as text.
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// JSONEncoder writes records as JSON objects, one per line:
+//
+// 	{"level":"info","time":"2015-06-16T12:00:00Z","msg":"Saved user","route":"POST /user","user":12}
+//
+// Errors are written as their messages. Values that cannot be encoded as JSON
+// are written as strings.
+type JSONEncoder struct{}
+
+// Encode writes a record as JSON.
+func (e JSONEncoder) Encode(r *Record) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"level":`)
+	writeJSON(&b, r.Level.String())
+	b.WriteString(`,"time":`)
+	writeJSON(&b, r.Time.Format(time.RFC3339Nano))
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, r.Message)
+	for _, f := range r.Fields {
+		b.WriteByte(',')
+		writeJSON(&b, f.Key)
+		b.WriteByte(':')
+		if err, ok := f.Value.(error); ok {
+			writeJSON(&b, err.Error())
+		} else {
+			writeJSON(&b, f.Value)
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+// ConsoleEncoder writes records for people to read:
+//
+// 	info    12:00:00 Saved user route="POST /user" user=12
+//
+// Each line starts with the level's name, so the output can be colored by
+// passing it through an io.Colorizer:
+//
+// 	cxt.AddLogger("stdout", io.NewColorizer(os.Stdout))
+type ConsoleEncoder struct {
+	// TimeFormat is the layout for the time. If empty, "15:04:05" is used.
+	TimeFormat string
+}
+
+// Encode writes a record as text.
+func (e ConsoleEncoder) Encode(r *Record) []byte {
+	format := e.TimeFormat
+	if len(format) == 0 {
+		format = "15:04:05"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%-7s %s %s", r.Level, r.Time.Format(format), r.Message)
+	writeLogfmtFields(&b, r.Fields)
+	return b.Bytes()
+}
@@ -0,0 +1,173 @@
+package log
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+)
+
+// DefaultEncoder is the Encoder used by Entry when the context does not name
+// one (see UseEncoder).
+var DefaultEncoder Encoder = LogfmtEncoder{}
+
+// EncoderKey is the context key that holds the Encoder for a context.
+const EncoderKey = "log.Encoder"
+
+// UseEncoder sets the Encoder for structured messages logged on a context.
+//
+// 	log.UseEncoder(cxt, log.JSONEncoder{})
+func UseEncoder(c cookoo.Context, e Encoder) {
+	c.Put(EncoderKey, e)
+}
+
+// autoFields are context values that are added to every structured message,
+// if they are set, along with the field names they are logged as.
+var autoFields = []struct{ key, field string }{
+	{"route.Name", "route"},
+	{"command.Name", "command"},
+	{cookoo.RequestIDKey, "request_id"},
+}
+
+// Entry is a structured log message in the making.
+//
+// An Entry holds key/value fields. Each of its level methods (Info, Errf,
+// and so on) logs a message with those fields:
+//
+// 	log.With(c, "user", id, "attempts", n).Warn("Login failed")
+//
+// With the default LogfmtEncoder, this writes:
+//
+// 	level=warning time=2015-06-16T12:00:00Z msg="Login failed" route="POST /login" command=auth user=12 attempts=3
+//
+// The route, command, and request_id fields are added automatically, from the
+// route.Name, command.Name, and request.ID context values.
+//
+// The encoded line is written to the context's loggers as-is, with no prefix
+// or timestamp of its own. (If the context is not a cookoo.RawLogger, it is
+// logged with an empty prefix.)
+//
+// As with the other functions in this package, messages above Level are
+// dropped.
+type Entry struct {
+	c      cookoo.Context
+	fields []Field
+}
+
+// With starts a structured message with the given key/value pairs.
+//
+// Keys should be strings. A key without a value gets a nil value.
+func With(c cookoo.Context, kv ...interface{}) *Entry {
+	return (&Entry{c: c}).With(kv...)
+}
+
+// With returns a new Entry with more key/value pairs.
+//
+// The original Entry is not changed, so an Entry can be used as a base for
+// many messages.
+func (e *Entry) With(kv ...interface{}) *Entry {
+	fields := make([]Field, len(e.fields), len(e.fields)+(len(kv)+1)/2)
+	copy(fields, e.fields)
+	for i := 0; i < len(kv); i += 2 {
+		f := Field{Key: fmt.Sprint(kv[i])}
+		if i+1 < len(kv) {
+			f.Value = kv[i+1]
+		}
+		fields = append(fields, f)
+	}
+	return &Entry{c: e.c, fields: fields}
+}
+
+// Fields returns the fields that will be logged, including the automatic
+// ones.
+func (e *Entry) Fields() []Field {
+	fields := make([]Field, 0, len(autoFields)+len(e.fields))
+	for _, auto := range autoFields {
+		if v, ok := e.c.Has(auto.key); ok && v != nil && v != "" {
+			fields = append(fields, Field{auto.field, v})
+		}
+	}
+	return append(fields, e.fields...)
+}
+
+// Log writes a message at the given level.
+func (e *Entry) Log(l LogLevel, args ...interface{}) {
+	if Level >= l {
+		e.write(l, fmt.Sprint(args...))
+	}
+}
+
+// Logf writes a formatted message at the given level.
+func (e *Entry) Logf(l LogLevel, msg string, args ...interface{}) {
+	if Level >= l {
+		e.write(l, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (e *Entry) write(l LogLevel, msg string) {
+	r := &Record{
+		Time:    time.Now(),
+		Level:   l,
+		Message: msg,
+		Fields:  e.Fields(),
+	}
+	enc, ok := e.c.Get(EncoderKey, nil).(Encoder)
+	if !ok {
+		enc = DefaultEncoder
+	}
+	line := enc.Encode(r)
+
+	if raw, ok := e.c.(cookoo.RawLogger); ok {
+		raw.LogRaw(line)
+		return
+	}
+	e.c.Log("", string(line))
+}
+
+// Emerg logs an emergency.
+func (e *Entry) Emerg(args ...interface{}) { e.Log(LogEmerg, args...) }
+
+// Alert logs an alert.
+func (e *Entry) Alert(args ...interface{}) { e.Log(LogAlert, args...) }
+
+// Crit logs a critical message.
+func (e *Entry) Crit(args ...interface{}) { e.Log(LogCrit, args...) }
+
+// Err logs an error message.
+func (e *Entry) Err(args ...interface{}) { e.Log(LogErr, args...) }
+
+// Warn logs a warning.
+func (e *Entry) Warn(args ...interface{}) { e.Log(LogWarning, args...) }
+
+// Notice logs a notice.
+func (e *Entry) Notice(args ...interface{}) { e.Log(LogNotice, args...) }
+
+// Info logs an informational message.
+func (e *Entry) Info(args ...interface{}) { e.Log(LogInfo, args...) }
+
+// Debug logs a debug message.
+func (e *Entry) Debug(args ...interface{}) { e.Log(LogDebug, args...) }
+
+// Emergf logs an emergency.
+func (e *Entry) Emergf(msg string, args ...interface{}) { e.Logf(LogEmerg, msg, args...) }
+
+// Alertf logs an alert.
+func (e *Entry) Alertf(msg string, args ...interface{}) { e.Logf(LogAlert, msg, args...) }
+
+// Critf logs a critical message.
+func (e *Entry) Critf(msg string, args ...interface{}) { e.Logf(LogCrit, msg, args...) }
+
+// Errf logs an error message.
+func (e *Entry) Errf(msg string, args ...interface{}) { e.Logf(LogErr, msg, args...) }
+
+// Warnf logs a warning.
+func (e *Entry) Warnf(msg string, args ...interface{}) { e.Logf(LogWarning, msg, args...) }
+
+// Noticef logs a notice.
+func (e *Entry) Noticef(msg string, args ...interface{}) { e.Logf(LogNotice, msg, args...) }
+
+// Infof logs an informational message.
+func (e *Entry) Infof(msg string, args ...interface{}) { e.Logf(LogInfo, msg, args...) }
+
+// Debugf logs a debug message.
+func (e *Entry) Debugf(msg string, args ...interface{}) { e.Logf(LogDebug, msg, args...) }
@@ -0,0 +1,89 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+)
+
+func TestWith(t *testing.T) {
+	_, _, c := cookoo.Cookoo()
+	var b bytes.Buffer
+	c.AddLogger("buffer", &b)
+	c.Put("route.Name", "GET /user")
+	c.Put("request.ID", "abc123")
+
+	Level = LogDebug
+	base := With(c, "user", 12)
+	base.With("status", "new user").Infof("Saved %s", "it")
+	line := b.String()
+
+	if !strings.HasPrefix(line, "level=info time=") {
+		t.Errorf("! Expected a logfmt line starting with the level, got %q", line)
+	}
+	expect := `msg="Saved it" route="GET /user" request_id=abc123 user=12 status="new user"` + "\n"
+	if !strings.HasSuffix(line, expect) {
+		t.Errorf("! Expected %q at the end of %q", expect, line)
+	}
+
+	// The base entry is unchanged.
+	b.Reset()
+	base.Debug("again")
+	if strings.Contains(b.String(), "status") {
+		t.Errorf("! Expected With to return a new Entry, got %q", b.String())
+	}
+
+	b.Reset()
+	Level = LogErr
+	base.Info("dropped")
+	Level = LogDebug
+	if b.Len() > 0 {
+		t.Errorf("! Expected messages above Level to be dropped, got %q", b.String())
+	}
+}
+
+func TestUseEncoder(t *testing.T) {
+	_, _, c := cookoo.Cookoo()
+	var b bytes.Buffer
+	c.AddLogger("buffer", &b)
+	UseEncoder(c, JSONEncoder{})
+
+	With(c, "err", errors.New("boom"), "n", 2, "odd").Err("Failed")
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(b.Bytes(), &out); err != nil {
+		t.Fatalf("! Expected JSON, got %q: %s", b.String(), err)
+	}
+	if out["level"] != "error" || out["msg"] != "Failed" || out["err"] != "boom" || out["n"] != 2.0 {
+		t.Errorf("! Unexpected JSON record: %v", out)
+	}
+	if v, ok := out["odd"]; !ok || v != nil {
+		t.Errorf("! Expected a key without a value to be null, got %v", v)
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	r := &Record{
+		Time:    time.Date(2015, 6, 16, 12, 0, 0, 0, time.UTC),
+		Level:   LogWarning,
+		Message: "Disk low",
+		Fields:  []Field{{"free", "5%"}, {"path", "/var/log"}, {"quote", `a"b`}},
+	}
+
+	logfmt := string(LogfmtEncoder{}.Encode(r))
+	expect := `level=warning time=2015-06-16T12:00:00Z msg="Disk low" free=5% path=/var/log quote="a\"b"`
+	if logfmt != expect {
+		t.Errorf("! Expected %q, got %q", expect, logfmt)
+	}
+
+	console := string(ConsoleEncoder{}.Encode(r))
+	expect = `warning 12:00:00 Disk low free=5% path=/var/log quote="a\"b"`
+	if console != expect {
+		t.Errorf("! Expected %q, got %q", expect, console)
+	}
+}
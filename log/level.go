@@ -0,0 +1,173 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Masterminds/cookoo"
+)
+
+// levelNames maps names and common abbreviations to levels.
+var levelNames = map[string]LogLevel{
+	"emergency": LogEmerg,
+	"emerg":     LogEmerg,
+	"panic":     LogEmerg,
+	"alert":     LogAlert,
+	"critical":  LogCrit,
+	"crit":      LogCrit,
+	"error":     LogErr,
+	"err":       LogErr,
+	"warning":   LogWarning,
+	"warn":      LogWarning,
+	"notice":    LogNotice,
+	"info":      LogInfo,
+	"debug":     LogDebug,
+}
+
+// ParseLevel reads a level from its name.
+//
+// Names are not case sensitive. The full names (like "warning"), the usual
+// abbreviations (like "warn" or "err"), labels (like "[warning]"), and the
+// numbers 0 through 7 are understood.
+func ParseLevel(name string) (LogLevel, error) {
+	s := strings.ToLower(strings.TrimSpace(name))
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if l, ok := levelNames[s]; ok {
+		return l, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= int(LogDebug) {
+		return LogLevel(n), nil
+	}
+	return LogDebug, fmt.Errorf("unknown log level %q", name)
+}
+
+// Set parses a level name into a LogLevel.
+//
+// Along with String, this makes a *LogLevel a flag.Value:
+//
+//	level := log.LogInfo
+//	flag.Var(&level, "log-level", "The log level (debug, info, warning, ...)")
+func (l *LogLevel) Set(name string) error {
+	level, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// LevelFromEnv reads a level from an environment variable.
+//
+// If the variable is not set, or does not name a level, the default is
+// returned.
+func LevelFromEnv(name string, def LogLevel) LogLevel {
+	if v := os.Getenv(name); len(v) > 0 {
+		if l, err := ParseLevel(v); err == nil {
+			return l
+		}
+	}
+	return def
+}
+
+// LeveledWriter is a logger that drops messages above its level.
+//
+// Wrap a writer in a LeveledWriter before adding it to a context, and each
+// logger can have a level of its own:
+//
+//	cxt.AddLogger("file", log.NewLeveledWriter(file, log.LogDebug))
+//	cxt.AddLogger("stdout", log.NewLeveledWriter(os.Stdout, log.LogInfo))
+//
+// The level of each message is read from the start of the line, which is
+// where this package puts it: a label (like "[warning] "), a logfmt level
+// field ("level=warning"), a JSON level field ({"level":"warning"), or the
+// level's name (as written by ConsoleEncoder, or by Context.Log with a prefix
+// like "warn"). Lines with no level are always written.
+//
+// The level may be changed at any time, from any goroutine.
+//
+// The package-level Level still applies before a message reaches any logger.
+// To filter only by logger, leave it at LogDebug.
+type LeveledWriter struct {
+	writer io.Writer
+	level  uint32
+}
+
+// NewLeveledWriter wraps a writer, keeping messages at or below the level.
+func NewLeveledWriter(w io.Writer, level LogLevel) *LeveledWriter {
+	return &LeveledWriter{writer: w, level: uint32(level)}
+}
+
+// Level returns the writer's level.
+func (w *LeveledWriter) Level() LogLevel {
+	return LogLevel(atomic.LoadUint32(&w.level))
+}
+
+// SetLevel changes the writer's level.
+func (w *LeveledWriter) SetLevel(level LogLevel) {
+	atomic.StoreUint32(&w.level, uint32(level))
+}
+
+// Enabled checks whether messages at the given level would be written.
+func (w *LeveledWriter) Enabled(level LogLevel) bool {
+	return level <= w.Level()
+}
+
+// Write writes the message if its level is enabled.
+//
+// Dropped messages are reported as written.
+func (w *LeveledWriter) Write(p []byte) (int, error) {
+	if level, ok := LineLevel(p); ok && !w.Enabled(level) {
+		return len(p), nil
+	}
+	return w.writer.Write(p)
+}
+
+// LineLevel finds the level at the start of a line of log output.
+//
+// See LeveledWriter for the formats that are understood.
+func LineLevel(line []byte) (LogLevel, bool) {
+	s := string(line)
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	switch {
+	case strings.HasPrefix(s, "["):
+		if end := strings.IndexByte(s, ']'); end > 0 {
+			s = s[1:end]
+		}
+	case strings.HasPrefix(s, "level="):
+		s = s[len("level="):]
+	case strings.HasPrefix(s, `{"level":"`):
+		s = s[len(`{"level":"`):]
+	}
+
+	// The name runs until the first character that is not a letter.
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z')
+	})
+	if end >= 0 {
+		s = s[:end]
+	}
+	l, ok := levelNames[strings.ToLower(s)]
+	return l, ok
+}
+
+// SetLoggerLevel changes the level of a named logger on a context.
+//
+// The logger must be a *LeveledWriter.
+func SetLoggerLevel(c cookoo.Context, name string, level LogLevel) error {
+	w, ok := c.Logger(name)
+	if !ok {
+		return fmt.Errorf("no logger named %s", name)
+	}
+	lw, ok := w.(*LeveledWriter)
+	if !ok {
+		return fmt.Errorf("logger %s is a %T, not a *LeveledWriter", name, w)
+	}
+	lw.SetLevel(level)
+	return nil
+}
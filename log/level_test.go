@@ -0,0 +1,127 @@
+package log
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/cookoo"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]LogLevel{
+		"debug":      LogDebug,
+		"INFO":       LogInfo,
+		" warn ":     LogWarning,
+		"warning":    LogWarning,
+		"err":        LogErr,
+		"[critical]": LogCrit,
+		"emerg":      LogEmerg,
+		"3":          LogErr,
+	}
+	for name, expect := range tests {
+		l, err := ParseLevel(name)
+		if err != nil {
+			t.Errorf("! Unexpected error for %q: %s", name, err)
+		} else if l != expect {
+			t.Errorf("! Expected %q to be %s, got %s", name, expect, l)
+		}
+	}
+
+	for _, name := range []string{"", "loud", "8", "-1"} {
+		if _, err := ParseLevel(name); err == nil {
+			t.Errorf("! Expected an error for %q", name)
+		}
+	}
+}
+
+func TestLevelFlag(t *testing.T) {
+	level := LogInfo
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&bytes.Buffer{})
+	fs.Var(&level, "log-level", "The log level.")
+
+	if err := fs.Parse([]string{"-log-level", "warning"}); err != nil {
+		t.Fatal(err)
+	}
+	if level != LogWarning {
+		t.Errorf("! Expected warning, got %s", level)
+	}
+	if err := fs.Parse([]string{"-log-level", "loud"}); err == nil {
+		t.Error("! Expected an error for an unknown level.")
+	}
+
+	os.Setenv("COOKOO_TEST_LOG_LEVEL", "debug")
+	defer os.Unsetenv("COOKOO_TEST_LOG_LEVEL")
+	if l := LevelFromEnv("COOKOO_TEST_LOG_LEVEL", LogInfo); l != LogDebug {
+		t.Errorf("! Expected debug from the environment, got %s", l)
+	}
+	if l := LevelFromEnv("COOKOO_TEST_NO_SUCH_VAR", LogNotice); l != LogNotice {
+		t.Errorf("! Expected the default, got %s", l)
+	}
+}
+
+func TestLineLevel(t *testing.T) {
+	tests := map[string]LogLevel{
+		"[error] 2015/06/16 12:00:00 Failed":               LogErr,
+		"level=debug time=2015-06-16T12:00:00Z msg=hi":     LogDebug,
+		`{"level":"notice","time":"2015-06-16T12:00:00Z"}`: LogNotice,
+		"warning 12:00:00 Careful":                         LogWarning,
+		"warn2015/06/16 12:00:00 Careful":                  LogWarning,
+	}
+	for line, expect := range tests {
+		l, ok := LineLevel([]byte(line))
+		if !ok || l != expect {
+			t.Errorf("! Expected %s for %q, got %s (%t)", expect, line, l, ok)
+		}
+	}
+
+	for _, line := range []string{"2015/06/16 12:00:00 Plain", "[x] 2015/06/16", "informal"} {
+		if l, ok := LineLevel([]byte(line)); ok {
+			t.Errorf("! Expected no level for %q, got %s", line, l)
+		}
+	}
+}
+
+func TestLeveledWriter(t *testing.T) {
+	_, _, c := cookoo.Cookoo()
+	var file, console bytes.Buffer
+	c.AddLogger("file", NewLeveledWriter(&file, LogDebug))
+	c.AddLogger("console", NewLeveledWriter(&console, LogInfo))
+	Level = LogDebug
+
+	Debug(c, "Details")
+	Info(c, "Started")
+	With(c, "n", 1).Debug("Structured details")
+	c.Log("", "No level")
+
+	if s := file.String(); !strings.Contains(s, "Details") || !strings.Contains(s, "Structured details") {
+		t.Errorf("! Expected debug messages in the file log, got %q", s)
+	}
+	if s := console.String(); strings.Contains(s, "Details") || strings.Contains(s, "details") {
+		t.Errorf("! Expected no debug messages on the console, got %q", s)
+	}
+	if s := console.String(); !strings.Contains(s, "Started") || !strings.Contains(s, "No level") {
+		t.Errorf("! Expected info and unleveled messages on the console, got %q", s)
+	}
+
+	// Change the console level at runtime.
+	if err := SetLoggerLevel(c, "console", LogDebug); err != nil {
+		t.Fatal(err)
+	}
+	console.Reset()
+	Debug(c, "Now visible")
+	if !strings.Contains(console.String(), "Now visible") {
+		t.Errorf("! Expected the new level to apply, got %q", console.String())
+	}
+
+	c.AddLogger("plain", &bytes.Buffer{})
+	if err := SetLoggerLevel(c, "plain", LogInfo); err == nil {
+		t.Error("! Expected an error for a logger that is not leveled.")
+	}
+	if err := SetLoggerLevel(c, "missing", LogInfo); err == nil {
+		t.Error("! Expected an error for a missing logger.")
+	}
+}
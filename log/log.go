@@ -8,6 +8,21 @@ formatter variants for all of the log levels.
 
 This uses the Context.Log* functions beneath the hood, so any logger
 configuration for that will also hold true for this.
+
+For structured logging, use With to attach key/value fields to a message:
+
+	log.With(c, "user", id).Info("Logged in")
+
+Structured messages are written by an Encoder (logfmt, JSON, or a console
+format) and carry the route, command, and request ID automatically. See Entry.
+
+Each logger on a context can have its own level. Wrap it in a LeveledWriter:
+
+	c.AddLogger("file", log.NewLeveledWriter(file, log.LogDebug))
+	c.AddLogger("stdout", log.NewLeveledWriter(os.Stdout, log.LogWarning))
+
+Levels can be read from flags or the environment with ParseLevel,
+LevelFromEnv, or flag.Var (a *LogLevel is a flag.Value).
 */
 package log
 
@@ -55,6 +70,10 @@ var Label = [8]string{
 	LabelDebug,
 }
 
+// Level is the highest level sent to any logger.
+//
+// Level applies to every context in the program. To give each logger its own
+// level, leave this at LogDebug and wrap the loggers in a LeveledWriter.
 var Level LogLevel = LogDebug
 
 // Debugging returns true if the level is set to allow debugging.
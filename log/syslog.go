@@ -0,0 +1,331 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facility is a syslog facility.
+type Facility int
+
+// Syslog facilities, as in log/syslog.
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	_
+	_
+	_
+	_
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// Priority combines a level and a facility into a syslog priority.
+//
+// The log levels have the same numbers as syslog severities, so LogErr is
+// syslog's LOG_ERR.
+func Priority(l LogLevel, f Facility) int {
+	return int(f)<<3 | int(l&7)
+}
+
+// syslogSockets are the usual places for the local syslog socket.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// JournalSocket is where journald listens for native messages.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// SyslogWriter is a logger that sends each message to syslog, with the
+// priority of its level.
+//
+// The level is read from the start of the line, just as LeveledWriter does,
+// and a "[level] " label is removed, since the priority carries it. Lines
+// with no level are sent with the Default level.
+//
+//	w, err := log.NewSyslogWriter("", "", log.FacilityDaemon, "myapp")
+//	if err != nil {
+//		// Handle the error.
+//	}
+//	cxt.AddLogger("syslog", w)
+//
+// Messages are written in the traditional BSD format (RFC 3164), ending in a
+// newline on stream connections (TCP or a unix stream socket). If a write
+// fails, the writer reconnects once and tries again.
+type SyslogWriter struct {
+	// Facility is the facility for every message.
+	Facility Facility
+	// Tag names the program. It defaults to the name of the executable.
+	Tag string
+	// Default is the level for lines that do not have one.
+	Default LogLevel
+
+	hostname string
+	network  string
+	addr     string
+	mutex    sync.Mutex
+	conn     net.Conn
+}
+
+// NewSyslogWriter connects to a syslog server.
+//
+// The network is "udp", "tcp", "unix" or "unixgram", and addr is the server's
+// address. If both are empty, the local syslog socket is used.
+func NewSyslogWriter(network, addr string, facility Facility, tag string) (*SyslogWriter, error) {
+	if len(tag) == 0 {
+		tag = programName()
+	}
+	w := &SyslogWriter{
+		Facility: facility,
+		Tag:      tag,
+		Default:  LogInfo,
+		network:  network,
+		addr:     addr,
+	}
+	// The local daemon fills in the hostname itself.
+	if len(network) > 0 {
+		w.hostname, _ = os.Hostname()
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends a message to syslog.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	level, msg := splitLevel(p, w.Default)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>%s ", Priority(level, w.Facility), time.Now().Format(time.Stamp))
+	if len(w.hostname) > 0 {
+		b.WriteString(w.hostname)
+		b.WriteByte(' ')
+	}
+	fmt.Fprintf(&b, "%s[%d]: %s", w.Tag, os.Getpid(), msg)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := sendOrRetry(&w.conn, w.connect, b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *SyslogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) connect() error {
+	var conn net.Conn
+	var err error
+	if len(w.network) > 0 {
+		if conn, err = net.Dial(w.network, w.addr); err != nil {
+			return err
+		}
+	} else if conn, err = dialLocal(syslogSockets); err != nil {
+		return errors.New("syslog: no local syslog socket found")
+	}
+	w.conn = frameStream(conn)
+	return nil
+}
+
+// frameStream makes a stream connection end each message with a newline, so
+// the server can tell where one message stops and the next begins. Datagram
+// connections are returned as they are.
+//
+// The local socket may be a stream, too, so this goes by the connection and
+// not by the network the writer was asked for.
+func frameStream(conn net.Conn) net.Conn {
+	switch conn.RemoteAddr().Network() {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return lineConn{conn}
+	}
+	return conn
+}
+
+// lineConn is a stream connection that writes each message as a line.
+type lineConn struct {
+	net.Conn
+}
+
+func (c lineConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(append(p[:len(p):len(p)], '\n'))
+	if n > len(p) {
+		n = len(p)
+	}
+	return n, err
+}
+
+// JournalWriter is a logger that sends each message to journald, using the
+// journal's native protocol.
+//
+// Like SyslogWriter, it reads the level from the start of each line and sends
+// it as the message's PRIORITY. The tag is sent as SYSLOG_IDENTIFIER and the
+// facility as SYSLOG_FACILITY, so journalctl can filter on them:
+//
+//	journalctl -t myapp -p warning
+type JournalWriter struct {
+	// Facility is the facility for every message.
+	Facility Facility
+	// Tag names the program. It defaults to the name of the executable.
+	Tag string
+	// Default is the level for lines that do not have one.
+	Default LogLevel
+
+	addr  string
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+// NewJournalWriter connects to journald.
+//
+// If addr is empty, JournalSocket is used.
+func NewJournalWriter(addr string, facility Facility, tag string) (*JournalWriter, error) {
+	if len(addr) == 0 {
+		addr = JournalSocket
+	}
+	if len(tag) == 0 {
+		tag = programName()
+	}
+	w := &JournalWriter{Facility: facility, Tag: tag, Default: LogInfo, addr: addr}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends a message to the journal.
+func (w *JournalWriter) Write(p []byte) (int, error) {
+	level, msg := splitLevel(p, w.Default)
+	var b bytes.Buffer
+	journalField(&b, "PRIORITY", fmt.Sprint(int(level)))
+	journalField(&b, "SYSLOG_FACILITY", fmt.Sprint(int(w.Facility)))
+	journalField(&b, "SYSLOG_IDENTIFIER", w.Tag)
+	journalField(&b, "SYSLOG_PID", fmt.Sprint(os.Getpid()))
+	journalField(&b, "MESSAGE", msg)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := sendOrRetry(&w.conn, w.connect, b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *JournalWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *JournalWriter) connect() error {
+	conn, err := net.Dial("unixgram", w.addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// journalField writes a field in the journal's native format. Values with
+// newlines are written with their length, as the protocol requires.
+func journalField(b *bytes.Buffer, key, value string) {
+	b.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// splitLevel finds the level of a line and returns it with the message,
+// less any level label and trailing newline.
+func splitLevel(p []byte, def LogLevel) (LogLevel, string) {
+	msg := strings.TrimRight(string(p), "\n")
+	level, ok := LineLevel(p)
+	if !ok {
+		return def, msg
+	}
+	if label := Label[level]; strings.HasPrefix(msg, label) {
+		msg = msg[len(label):]
+	}
+	return level, msg
+}
+
+// sendOrRetry writes a message to a connection, reconnecting once if the
+// write fails. The caller must hold the writer's lock.
+func sendOrRetry(conn *net.Conn, connect func() error, msg []byte) error {
+	if *conn != nil {
+		if _, err := (*conn).Write(msg); err == nil {
+			return nil
+		}
+		(*conn).Close()
+		*conn = nil
+	}
+	if err := connect(); err != nil {
+		return err
+	}
+	_, err := (*conn).Write(msg)
+	return err
+}
+
+func dialLocal(paths []string) (net.Conn, error) {
+	var err error
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			var conn net.Conn
+			if conn, err = net.Dial(network, path); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+func programName() string {
+	name := os.Args[0]
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
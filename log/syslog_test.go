@@ -0,0 +1,155 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+)
+
+func TestPriority(t *testing.T) {
+	if p := Priority(LogErr, FacilityUser); p != 11 {
+		t.Errorf("! Expected user.err to be 11, got %d", p)
+	}
+	if p := Priority(LogDebug, FacilityLocal7); p != 191 {
+		t.Errorf("! Expected local7.debug to be 191, got %d", p)
+	}
+}
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestSyslogWriter(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Cannot listen on UDP: %s", err)
+	}
+	defer server.Close()
+
+	w, err := NewSyslogWriter("udp", server.LocalAddr().String(), FacilityLocal0, "cookoo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	_, _, c := cookoo.Cookoo()
+	c.AddLogger("syslog", w)
+	Level = LogDebug
+
+	Errf(c, "Failed %s", "now")
+	msg := readPacket(t, server)
+	expect := regexp.MustCompile(`^<131>\w{3} [ \d]\d \d\d:\d\d:\d\d \S+ cookoo-test\[\d+\]: \S+ \S+ Failed now$`)
+	if !expect.MatchString(msg) {
+		t.Errorf("! Unexpected syslog message %q", msg)
+	}
+
+	With(c, "n", 1).Warn("Careful")
+	if msg := readPacket(t, server); !strings.HasPrefix(msg, "<132>") || !strings.Contains(msg, "level=warning") {
+		t.Errorf("! Expected a warning with logfmt fields, got %q", msg)
+	}
+
+	c.Log("", "No level")
+	if msg := readPacket(t, server); !strings.HasPrefix(msg, "<134>") {
+		t.Errorf("! Expected the default info priority, got %q", msg)
+	}
+}
+
+func TestSyslogWriterStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cookoo-syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "socket")
+
+	server, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Skipf("Cannot listen on a unix socket: %s", err)
+	}
+	defer server.Close()
+
+	// The local socket is a stream here, so messages must be framed.
+	defer func(old []string) { syslogSockets = old }(syslogSockets)
+	syslogSockets = []string{addr}
+
+	w, err := NewSyslogWriter("", "", FacilityDaemon, "cookoo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	conn, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w.Write([]byte("[notice] Started\n"))
+	w.Write([]byte("Still going"))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	lines := bufio.NewScanner(conn)
+	for _, expect := range []string{"Started", "Still going"} {
+		if !lines.Scan() {
+			t.Fatalf("! Expected a line for %q: %v", expect, lines.Err())
+		}
+		if msg := lines.Text(); !strings.HasSuffix(msg, ": "+expect) {
+			t.Errorf("! Expected a line ending in %q, got %q", expect, msg)
+		}
+	}
+}
+
+func TestJournalWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cookoo-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "socket")
+
+	server, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skipf("Cannot listen on a unix socket: %s", err)
+	}
+	defer server.Close()
+
+	w, err := NewJournalWriter(addr, FacilityDaemon, "cookoo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("[notice] Started\n"))
+	msg := readPacket(t, server)
+	for _, field := range []string{"PRIORITY=5\n", "SYSLOG_FACILITY=3\n", "SYSLOG_IDENTIFIER=cookoo-test\n", "MESSAGE=Started\n"} {
+		if !strings.Contains(msg, field) {
+			t.Errorf("! Expected %q in %q", field, msg)
+		}
+	}
+
+	w.Write([]byte("debug two\nlines"))
+	msg = readPacket(t, server)
+	var b bytes.Buffer
+	b.WriteString("MESSAGE\n")
+	binary.Write(&b, binary.LittleEndian, uint64(len("debug two\nlines")))
+	b.WriteString("debug two\nlines\n")
+	if !strings.Contains(msg, "PRIORITY=7\n") || !strings.HasSuffix(msg, b.String()) {
+		t.Errorf("! Expected a binary-safe multi-line message, got %q", msg)
+	}
+}
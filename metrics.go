@@ -0,0 +1,325 @@
+package cookoo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricsKey is the context key under which a MetricsTracer stores itself.
+const MetricsKey = "metrics.Tracer"
+
+// DefaultBuckets are the latency histogram buckets, in seconds, used when
+// NewMetricsTracer is given none.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricsTracer is a Tracer that counts routes and commands, and measures how
+// long they take.
+//
+// It keeps the following metrics:
+//
+// 	- cookoo_route_runs_total{route}: The number of times each route ran.
+// 	- cookoo_route_errors_total{route,type}: Routes that ended with an error,
+// 	  by the error's type (FatalError, Canceled, RouteError for a Reroute to
+// 	  a route that does not exist, and so on).
+// 	- cookoo_request_errors_total{type}: Requests that failed before any
+// 	  route ran, by the error's type. A request for a route that does not
+// 	  exist is a RouteError; on the web, a 405 is a MethodNotAllowedError.
+// 	  These have no route label, since the request names no route.
+// 	- cookoo_route_duration_seconds{route}: A histogram of route run times.
+// 	- cookoo_command_interrupts_total{route,command,type}: Interrupts
+// 	  returned by commands, by type (FatalError, RecoverableError, Reroute,
+// 	  Stop, ...).
+// 	- cookoo_command_duration_seconds{route,command}: A histogram of command
+// 	  run times.
+//
+// Routes reached by a Reroute or an error handler are counted, too.
+//
+// WriteTo writes the metrics in the Prometheus text format. To serve them over
+// HTTP, add the tracer to the router and use the web.Metrics command:
+//
+// 	router.AddTracer(cookoo.NewMetricsTracer())
+// 	reg.Route("GET /metrics", "Metrics").Does(web.Metrics, "metrics")
+//
+// When a route starts, the tracer puts itself into the context under
+// MetricsKey, which is where web.Metrics looks for it.
+type MetricsTracer struct {
+	buckets []float64
+
+	mutex      sync.Mutex
+	routeRuns  map[string]uint64
+	routeErrs  map[[2]string]uint64
+	routeTimes map[string]*histogram
+	reqErrs    map[string]uint64
+	cmdIrqs    map[[3]string]uint64
+	cmdTimes   map[[2]string]*histogram
+}
+
+// histogram counts observations into buckets. The counts are not cumulative;
+// they are added up when written.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	for i, b := range buckets {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) copy() *histogram {
+	c := *h
+	if h.counts != nil {
+		c.counts = append([]uint64{}, h.counts...)
+	}
+	return &c
+}
+
+// NewMetricsTracer creates a MetricsTracer with the given histogram buckets,
+// in seconds. With no buckets, DefaultBuckets are used.
+func NewMetricsTracer(buckets ...float64) *MetricsTracer {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &MetricsTracer{
+		buckets:    buckets,
+		routeRuns:  map[string]uint64{},
+		routeErrs:  map[[2]string]uint64{},
+		routeTimes: map[string]*histogram{},
+		reqErrs:    map[string]uint64{},
+		cmdIrqs:    map[[3]string]uint64{},
+		cmdTimes:   map[[2]string]*histogram{},
+	}
+}
+
+// RouteStart puts the tracer into the context.
+func (t *MetricsTracer) RouteStart(cxt Context, ev *RouteEvent) {
+	if ev.Parent == nil {
+		cxt.Put(MetricsKey, t)
+	}
+}
+
+// CommandStart does nothing.
+func (t *MetricsTracer) CommandStart(cxt Context, ev *CommandEvent) {}
+
+// CommandEnd records the command's time and interrupt.
+func (t *MetricsTracer) CommandEnd(cxt Context, ev *CommandEvent) {
+	key := [2]string{ev.Route.Name, ev.Name}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	h, ok := t.cmdTimes[key]
+	if !ok {
+		h = &histogram{}
+		t.cmdTimes[key] = h
+	}
+	h.observe(t.buckets, ev.Duration.Seconds())
+	if ev.Interrupt != nil {
+		t.cmdIrqs[[3]string{ev.Route.Name, ev.Name, TypeName(ev.Interrupt)}]++
+	}
+}
+
+// RouteEnd records the route's run, time, and error.
+func (t *MetricsTracer) RouteEnd(cxt Context, ev *RouteEvent) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.routeRuns[ev.Name]++
+	h, ok := t.routeTimes[ev.Name]
+	if !ok {
+		h = &histogram{}
+		t.routeTimes[ev.Name] = h
+	}
+	h.observe(t.buckets, ev.Duration.Seconds())
+	if ev.Err != nil {
+		t.routeErrs[[2]string{ev.Name, TypeName(ev.Err)}]++
+	}
+}
+
+// RequestError records a request that failed before any route ran.
+func (t *MetricsTracer) RequestError(cxt Context, name string, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.reqErrs[TypeName(err)]++
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (t *MetricsTracer) WriteTo(w io.Writer) (int64, error) {
+	// Format a copy, so routes are not held up by a slow writer.
+	m := t.snapshot()
+
+	cw := &countingWriter{w: w}
+	b := bufio.NewWriter(cw)
+
+	writeHeader(b, "cookoo_route_runs_total", "counter", "Number of times each route ran.")
+	for _, k := range sortedKeys(m.routeRuns) {
+		fmt.Fprintf(b, "cookoo_route_runs_total{%s} %d\n", labels("route", k), m.routeRuns[k])
+	}
+
+	writeHeader(b, "cookoo_route_errors_total", "counter", "Number of routes that ended in an error, by error type.")
+	errKeys := make([][]string, 0, len(m.routeErrs))
+	for k := range m.routeErrs {
+		errKeys = append(errKeys, []string{k[0], k[1]})
+	}
+	sortKeys(errKeys)
+	for _, k := range errKeys {
+		fmt.Fprintf(b, "cookoo_route_errors_total{%s} %d\n", labels("route", k[0], "type", k[1]), m.routeErrs[[2]string{k[0], k[1]}])
+	}
+
+	writeHeader(b, "cookoo_route_duration_seconds", "histogram", "Time taken by each route.")
+	for _, k := range sortedKeys(m.routeTimes) {
+		m.writeHistogram(b, "cookoo_route_duration_seconds", labels("route", k), m.routeTimes[k])
+	}
+
+	writeHeader(b, "cookoo_request_errors_total", "counter", "Number of requests that failed before a route ran, by error type.")
+	for _, k := range sortedKeys(m.reqErrs) {
+		fmt.Fprintf(b, "cookoo_request_errors_total{%s} %d\n", labels("type", k), m.reqErrs[k])
+	}
+
+	writeHeader(b, "cookoo_command_interrupts_total", "counter", "Number of interrupts returned by commands, by type.")
+	irqKeys := make([][]string, 0, len(m.cmdIrqs))
+	for k := range m.cmdIrqs {
+		irqKeys = append(irqKeys, []string{k[0], k[1], k[2]})
+	}
+	sortKeys(irqKeys)
+	for _, k := range irqKeys {
+		fmt.Fprintf(b, "cookoo_command_interrupts_total{%s} %d\n", labels("route", k[0], "command", k[1], "type", k[2]), m.cmdIrqs[[3]string{k[0], k[1], k[2]}])
+	}
+
+	writeHeader(b, "cookoo_command_duration_seconds", "histogram", "Time taken by each command.")
+	cmdKeys := make([][]string, 0, len(m.cmdTimes))
+	for k := range m.cmdTimes {
+		cmdKeys = append(cmdKeys, []string{k[0], k[1]})
+	}
+	sortKeys(cmdKeys)
+	for _, k := range cmdKeys {
+		m.writeHistogram(b, "cookoo_command_duration_seconds", labels("route", k[0], "command", k[1]), m.cmdTimes[[2]string{k[0], k[1]}])
+	}
+
+	err := b.Flush()
+	return cw.n, err
+}
+
+// snapshot copies the metrics, holding the lock only while it copies.
+func (t *MetricsTracer) snapshot() *MetricsTracer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	m := &MetricsTracer{
+		buckets:    t.buckets,
+		routeRuns:  make(map[string]uint64, len(t.routeRuns)),
+		routeErrs:  make(map[[2]string]uint64, len(t.routeErrs)),
+		routeTimes: make(map[string]*histogram, len(t.routeTimes)),
+		reqErrs:    make(map[string]uint64, len(t.reqErrs)),
+		cmdIrqs:    make(map[[3]string]uint64, len(t.cmdIrqs)),
+		cmdTimes:   make(map[[2]string]*histogram, len(t.cmdTimes)),
+	}
+	for k, v := range t.routeRuns {
+		m.routeRuns[k] = v
+	}
+	for k, v := range t.routeErrs {
+		m.routeErrs[k] = v
+	}
+	for k, h := range t.routeTimes {
+		m.routeTimes[k] = h.copy()
+	}
+	for k, v := range t.reqErrs {
+		m.reqErrs[k] = v
+	}
+	for k, v := range t.cmdIrqs {
+		m.cmdIrqs[k] = v
+	}
+	for k, h := range t.cmdTimes {
+		m.cmdTimes[k] = h.copy()
+	}
+	return m
+}
+
+func (t *MetricsTracer) writeHistogram(b *bufio.Writer, name, lbls string, h *histogram) {
+	var total uint64
+	for i, bound := range t.buckets {
+		if h.counts != nil {
+			total += h.counts[i]
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, lbls, formatFloat(bound), total)
+	}
+	fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, lbls, h.count)
+	fmt.Fprintf(b, "%s_sum{%s} %s\n", name, lbls, formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count{%s} %d\n", name, lbls, h.count)
+}
+
+func writeHeader(b *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labels formats name/value pairs as Prometheus labels.
+func labels(kv ...string) string {
+	parts := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		parts = append(parts, kv[i]+`="`+labelEscaper.Replace(kv[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// TypeName returns the name of a value's type, without the package or
+// pointer, like "FatalError". Tracers use it to label interrupts and errors.
+func TypeName(v interface{}) string {
+	name := fmt.Sprintf("%T", v)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimLeft(name, "*")
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	switch m := m.(type) {
+	case map[string]uint64:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*histogram:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortKeys(keys [][]string) {
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i], "\x00") < strings.Join(keys[j], "\x00")
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,72 @@
+package cookoo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetricsTracer(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.
+		Route("TEST", "A test route").
+		Does(FetchParams, "first").
+		Does(RecoverableErrorCommand, "oops").
+		Does(RerouteCommand, "forward").Using("route").WithDefault("TEST2").
+		Route("TEST2", "Rerouted").
+		Does(FatalErrorCommand, "fail").
+		Route("MISSING", "Goes nowhere").
+		Does(RerouteCommand, "forward").Using("route").WithDefault("nope")
+
+	m := NewMetricsTracer(0.5, 0.1)
+	router.AddTracer(m)
+
+	router.HandleRequest("TEST", cxt, false)
+	router.HandleRequest("TEST", cxt, false)
+	router.HandleRequest("MISSING", cxt, false)
+	router.HandleRequest("nope", cxt, false)
+
+	if cxt.Get(MetricsKey, nil) != m {
+		t.Error("! Expected the tracer in the context.")
+	}
+
+	var b bytes.Buffer
+	n, err := m.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) {
+		t.Fatalf("! Unexpected result from WriteTo: %d, %v", n, err)
+	}
+	out := b.String()
+
+	expect := []string{
+		"# TYPE cookoo_route_runs_total counter\n",
+		`cookoo_route_runs_total{route="TEST"} 2` + "\n",
+		`cookoo_route_runs_total{route="TEST2"} 2` + "\n",
+		`cookoo_route_errors_total{route="MISSING",type="RouteError"} 1` + "\n",
+		`cookoo_route_errors_total{route="TEST",type="FatalError"} 2` + "\n",
+		`cookoo_route_errors_total{route="TEST2",type="FatalError"} 2` + "\n",
+		`cookoo_request_errors_total{type="RouteError"} 1` + "\n",
+		"# TYPE cookoo_route_duration_seconds histogram\n",
+		`cookoo_route_duration_seconds_bucket{route="TEST",le="0.1"} 2` + "\n",
+		`cookoo_route_duration_seconds_bucket{route="TEST",le="0.5"} 2` + "\n",
+		`cookoo_route_duration_seconds_bucket{route="TEST",le="+Inf"} 2` + "\n",
+		`cookoo_route_duration_seconds_count{route="TEST"} 2` + "\n",
+		`cookoo_command_interrupts_total{route="TEST",command="forward",type="Reroute"} 2` + "\n",
+		`cookoo_command_interrupts_total{route="TEST",command="oops",type="RecoverableError"} 2` + "\n",
+		`cookoo_command_interrupts_total{route="TEST2",command="fail",type="FatalError"} 2` + "\n",
+		`cookoo_command_duration_seconds_count{route="TEST",command="first"} 2` + "\n",
+	}
+	for _, e := range expect {
+		if !strings.Contains(out, e) {
+			t.Errorf("! Expected %q in:\n%s", e, out)
+		}
+	}
+	if strings.Contains(out, `command="first",type=`) {
+		t.Error("! Expected no interrupts for a command that returned none.")
+	}
+}
+
+func TestMetricsLabels(t *testing.T) {
+	if l := labels("route", "GET /\"a\"\\\n"); l != `route="GET /\"a\"\\\n"` {
+		t.Errorf("! Expected escaped label values, got %s", l)
+	}
+}
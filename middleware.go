@@ -0,0 +1,105 @@
+package cookoo
+
+import (
+	"strings"
+)
+
+// Middleware wraps a Command inside of another Command.
+//
+// Middleware receives the next Command in line and returns a Command that
+// will be run in its place. The returned Command may do work before and
+// after calling next, may change the Params, or may skip next altogether.
+//
+// This is useful for things that apply to many commands, such as timing,
+// panic capture, authentication checks, and tracing. Rather than adding
+// the same commands to the top of every route, wrap the commands:
+//
+// 	func Timer(next cookoo.Command) cookoo.Command {
+// 		return func(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+// 			start := time.Now()
+// 			res, irq := next(c, p)
+// 			c.Logf("info", "%s took %s", c.Get("command.Name", ""), time.Since(start))
+// 			return res, irq
+// 		}
+// 	}
+//
+// 	reg.Use(Timer)
+//
+// Middleware can be registered globally (Registry.Use), for all routes whose
+// names begin with a prefix (Registry.UseFor), for a single route
+// (Registry.UseOnRoute or Route.Use), or for a single command
+// (Registry.UseOnCommand, Cmd.Use, or CmdDef.Use).
+//
+// Params are resolved before the middleware is called, so middleware sees
+// the same Params the command does. The context values `route.Name` and
+// `command.Name` are set before the middleware is called.
+//
+// When several middleware apply to a command, they are nested from the
+// outside in: global middleware first, then prefix middleware, then route
+// middleware, and finally command middleware. Within each group, the first
+// middleware declared is the outermost.
+type Middleware func(next Command) Command
+
+// prefixMiddleware is middleware that applies to routes with a common prefix.
+type prefixMiddleware struct {
+	prefix     string
+	middleware []Middleware
+}
+
+// Use adds middleware that wraps every command on every route.
+func (r *Registry) Use(mw ...Middleware) *Registry {
+	r.middleware = append(r.middleware, mw...)
+	return r
+}
+
+// UseFor adds middleware that wraps every command on every route whose name
+// begins with prefix.
+//
+// 	reg.UseFor("GET /admin", RequireAdmin)
+func (r *Registry) UseFor(prefix string, mw ...Middleware) *Registry {
+	r.prefixMiddleware = append(r.prefixMiddleware, &prefixMiddleware{prefix, mw})
+	return r
+}
+
+// UseOnRoute adds middleware that wraps every command on the current (most
+// recently specified) route.
+//
+// Commands brought in with Includes are wrapped, too, but only when they are
+// run as part of this route.
+func (r *Registry) UseOnRoute(mw ...Middleware) *Registry {
+	r.currentRoute.middleware = append(r.currentRoute.middleware, mw...)
+	return r
+}
+
+// UseOnCommand adds middleware that wraps the most recently specified command
+// as set by Does.
+//
+// Because Includes shares commands between routes, the middleware also
+// applies when the command is run by a route that includes this one.
+func (r *Registry) UseOnCommand(mw ...Middleware) *Registry {
+	cmd := r.lastCommandFor("UseOnCommand")
+	cmd.middleware = append(cmd.middleware, mw...)
+	return r
+}
+
+// wrapCommand returns the command wrapped by all of the middleware that
+// applies to it when it is run on the given route.
+func (r *Registry) wrapCommand(route *routeSpec, cmd *commandSpec) Command {
+	fn := wrapMiddleware(cmd.command, cmd.middleware)
+	fn = wrapMiddleware(fn, route.middleware)
+	for i := len(r.prefixMiddleware) - 1; i >= 0; i-- {
+		pm := r.prefixMiddleware[i]
+		if strings.HasPrefix(route.name, pm.prefix) {
+			fn = wrapMiddleware(fn, pm.middleware)
+		}
+	}
+	return wrapMiddleware(fn, r.middleware)
+}
+
+// wrapMiddleware wraps fn so that the first middleware is the outermost.
+func wrapMiddleware(fn Command, mw []Middleware) Command {
+	for i := len(mw) - 1; i >= 0; i-- {
+		fn = mw[i](fn)
+	}
+	return fn
+}
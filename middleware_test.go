@@ -0,0 +1,108 @@
+package cookoo
+
+import (
+	"strings"
+	"testing"
+)
+
+// recorder returns middleware that appends its name to the "trail" context
+// value before and after calling the next command.
+func recorder(name string) Middleware {
+	return func(next Command) Command {
+		return func(c Context, p *Params) (interface{}, Interrupt) {
+			trail := c.Get("trail", []string{}).([]string)
+			c.Put("trail", append(trail, name))
+			res, irq := next(c, p)
+			trail = c.Get("trail", []string{}).([]string)
+			c.Put("trail", append(trail, "/"+name))
+			return res, irq
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	reg, router, cxt := Cookoo()
+
+	reg.Use(recorder("global")).
+		UseFor("GET /api", recorder("prefix")).
+		UseFor("GET /other", recorder("other"))
+
+	reg.Route("GET /api/users", "Test middleware").
+		UseOnRoute(recorder("route")).
+		Does(MockCommand, "cmd").
+		UseOnCommand(recorder("cmd"))
+
+	if err := router.HandleRequest("GET /api/users", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "global prefix route cmd /cmd /route /prefix /global"
+	trail := strings.Join(cxt.Get("trail", nil).([]string), " ")
+	if trail != expect {
+		t.Errorf("! Expected %q, got %q", expect, trail)
+	}
+	if cxt.Get("cmd", false) != true {
+		t.Error("! Expected the wrapped command to run.")
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	reg, router, cxt := Cookoo()
+
+	deny := func(next Command) Command {
+		return func(c Context, p *Params) (interface{}, Interrupt) {
+			if c.Get("command.Name", "") == "secret" {
+				return nil, &FatalError{"Denied"}
+			}
+			return next(c, p)
+		}
+	}
+
+	reg.AddRoute(Route{
+		Name: "test",
+		Use:  []Middleware{deny},
+		Does: Tasks{
+			Cmd{Name: "first", Fn: FetchParams, Using: []Param{{Name: "a", DefaultValue: 1}}},
+			Cmd{Name: "secret", Fn: MockCommand},
+		},
+	})
+
+	err := router.HandleRequest("test", cxt, false)
+	if err == nil || err.Error() != "Denied" {
+		t.Errorf("! Expected middleware to deny command, got %v", err)
+	}
+	if p, ok := cxt.Get("first", nil).(*Params); !ok || p.Get("a", 0) != 1 {
+		t.Error("! Expected middleware to pass resolved params through.")
+	}
+	if _, ok := cxt.Has("secret"); !ok {
+		t.Error("! Expected the denied command to store a nil result.")
+	}
+}
+
+func TestMiddlewareIncludes(t *testing.T) {
+	reg, router, cxt := Cookoo()
+
+	reg.Route("@base", "Shared").
+		Does(MockCommand, "shared").
+		UseOnCommand(recorder("shared")).
+		Route("main", "Includes shared").
+		UseOnRoute(recorder("main")).
+		Includes("@base")
+
+	if err := router.HandleRequest("main", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	trail := strings.Join(cxt.Get("trail", nil).([]string), " ")
+	if trail != "main shared /shared /main" {
+		t.Errorf("! Unexpected trail %q", trail)
+	}
+
+	cxt = NewContext()
+	if err := router.HandleRequest("@base", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	trail = strings.Join(cxt.Get("trail", nil).([]string), " ")
+	if trail != "shared /shared" {
+		t.Errorf("! Route middleware leaked into included route: %q", trail)
+	}
+}
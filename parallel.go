@@ -0,0 +1,241 @@
+package cookoo
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParallelPolicy says what a Parallel group does when its commands fail.
+//
+// Whatever the policy, every command in the group is allowed to finish before
+// the policy is applied.
+type ParallelPolicy int
+
+const (
+	// FailOnFatal fails the group if any command returns a FatalError (or any
+	// other error). RecoverableErrors are logged, as they would be on a route.
+	// This is the default.
+	FailOnFatal ParallelPolicy = iota
+	// FailOnAny fails the group if any command returns a FatalError or a
+	// RecoverableError.
+	FailOnAny
+	// ContinueOnError never fails the group. If any command fails, the group
+	// returns a RecoverableError listing the failures, and the route goes on.
+	ContinueOnError
+)
+
+// Parallel is a Task that runs a group of Tasks at the same time.
+//
+// 	cookoo.Route{
+// 		Name: "GET /dashboard",
+// 		Does: cookoo.Tasks{
+// 			cookoo.Parallel{
+// 				Name: "fetch",
+// 				Does: cookoo.Tasks{
+// 					cookoo.Cmd{Name: "user", Fn: LoadUser},
+// 					cookoo.Cmd{Name: "news", Fn: LoadNews},
+// 				},
+// 			},
+// 			cookoo.Cmd{Name: "render", Fn: Render},
+// 		},
+// 	}
+//
+// See Registry.Parallel for how the group runs.
+type Parallel struct {
+	Name   string
+	Does   Tasks
+	Policy ParallelPolicy
+	Catch  string
+}
+
+func (p Parallel) getParams() Parameters {
+	return Parameters{}
+}
+
+// Parallel starts a group of commands that will run at the same time.
+//
+// Every command added with Does (or Includes) until the matching End is
+// part of the group:
+//
+// 	reg.Route("GET /dashboard", "Show the dashboard").
+// 		Parallel("fetch", cookoo.FailOnFatal).
+// 			Does(LoadUser, "user").Using("id").From("query:id").
+// 			Does(LoadNews, "news").
+// 		End().
+// 		Does(Render, "render")
+//
+// When the route reaches the group, each command in it is started in its
+// own goroutine, and the route waits for all of them to finish. The commands
+// share a synchronized copy of the context (see SyncContext), so they may
+// safely read and write context values. Each command's params are resolved
+// before any of the commands start, so commands in a group cannot use each
+// other's results.
+//
+// As usual, each command's result is put into the context under the
+// command's name. The group's own result, stored under the group's name, is a
+// map[string]interface{} of each command's name to its result.
+//
+// Once all of the commands have finished, the group fails according to
+// the policy. Otherwise, if any command returned a Reroute or a Stop, the
+// first one (in the order the commands were declared) is used. Catch and
+// OnError treat a failed group just like a failed command.
+//
+// Since the commands run at the same time, the `command.Name` context value is
+// not meaningful while a group is running.
+//
+// If a command panics, the panic is raised again in the goroutine that runs
+// the route once every command has finished.
+func (r *Registry) Parallel(name string, policy ParallelPolicy) *Registry {
+	spec := &commandSpec{
+		name:  name,
+		block: &blockSpec{policy: policy},
+	}
+	r.addCommand(spec)
+	r.openBlocks = append(r.openBlocks, spec)
+	return r
+}
+
+// End closes the most recently started group.
+//
+// After End, Does adds commands to the enclosing group, or to the route
+// itself.
+func (r *Registry) End() *Registry {
+	if n := len(r.openBlocks); n > 0 {
+		r.openBlocks = r.openBlocks[:n-1]
+	}
+	return r
+}
+
+// parallelTask is a command in a group, ready to run.
+type parallelTask struct {
+	cmd    *commandSpec
+	ev     *CommandEvent
+	params *Params
+	// paramErr is set if the params could not be resolved.
+	paramErr error
+	// tasks are set instead of params when the command is itself a group.
+	tasks []*parallelTask
+
+	res      interface{}
+	irq      Interrupt
+	panicked interface{}
+}
+
+// prepareBlock creates the events and resolves the params for every command
+// in a group.
+//
+// This is done before anything starts, so that the trace keeps the order in
+// which the commands were declared, and so that no command in the group sees
+// another's results.
+func (r *Router) prepareBlock(route *routeSpec, group *commandSpec, rev *RouteEvent, cxt Context) []*parallelTask {
+	tasks := make([]*parallelTask, len(group.block.commands))
+	for i, cmd := range group.block.commands {
+		t := &parallelTask{cmd: cmd, ev: &CommandEvent{Name: cmd.name, Route: rev}}
+		rev.Commands = append(rev.Commands, t.ev)
+		if cmd.block != nil {
+			t.tasks = r.prepareBlock(route, cmd, rev, cxt)
+		} else {
+			t.params, t.paramErr = r.resolveParams(route, cmd, cxt)
+		}
+		tasks[i] = t
+	}
+	return tasks
+}
+
+// runBlock runs every command in a group at the same time, and then applies
+// the group's policy to the results.
+func (r *Router) runBlock(route *routeSpec, group *commandSpec, tasks []*parallelTask, ev *CommandEvent, cxt Context) (interface{}, Interrupt) {
+	ev.Start = time.Now()
+	r.traceCommandStart(cxt, ev)
+	defer r.endCommandOnPanic(cxt, ev)
+
+	// All of the commands share one synchronized context.
+	scxt := cxt
+	if _, ok := cxt.(*synchronizedContext); !ok {
+		scxt = SyncContext(cxt)
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t *parallelTask) {
+			defer wg.Done()
+			defer func() {
+				if err := recover(); err != nil {
+					t.panicked = err
+				}
+			}()
+			if err := StdContext(scxt).Err(); err != nil {
+				t.irq = &Canceled{route.name, err}
+				return
+			}
+			if t.cmd.block != nil {
+				t.res, t.irq = r.runBlock(route, t.cmd, t.tasks, t.ev, scxt)
+			} else {
+				t.res, t.irq = r.callCommand(route, t.cmd, t.params, t.paramErr, t.ev, scxt)
+			}
+			// This may store a nil.
+			scxt.Put(t.cmd.name, t.res)
+		}(t)
+	}
+	wg.Wait()
+
+	res, irq := r.blockResult(route, group, tasks, cxt)
+
+	ev.Duration = time.Since(ev.Start)
+	ev.Result = res
+	ev.Interrupt = irq
+	r.traceCommandEnd(cxt, ev)
+	return res, irq
+}
+
+// blockResult merges the results of a group's commands, and picks the
+// interrupt for the group as a whole.
+func (r *Router) blockResult(route *routeSpec, group *commandSpec, tasks []*parallelTask, cxt Context) (interface{}, Interrupt) {
+	results := make(map[string]interface{}, len(tasks))
+	failures := []string{}
+	var failure, other Interrupt
+	for _, t := range tasks {
+		if t.panicked != nil {
+			panic(t.panicked)
+		}
+		results[t.cmd.name] = t.res
+		if t.irq == nil {
+			continue
+		}
+
+		switch irq := t.irq.(type) {
+		case *Reroute, *Stop:
+			if other == nil {
+				other = irq
+			}
+		case *RecoverableError:
+			if group.block.policy != FailOnAny {
+				cxt.Logf("warn", "Continuing after Recoverable Error in group %s on route %s: %v", group.name, route.name, irq)
+				continue
+			}
+			failures = append(failures, fmt.Sprintf("%s: %s", t.cmd.name, irq))
+			if failure == nil {
+				failure = &FatalError{irq.Message}
+			}
+		default:
+			failures = append(failures, fmt.Sprintf("%s: %v", t.cmd.name, irq))
+			if failure == nil {
+				failure = irq
+			}
+		}
+	}
+
+	if failure == nil {
+		return results, other
+	}
+	if _, ok := failure.(*Canceled); ok {
+		return results, failure
+	}
+	if group.block.policy == ContinueOnError {
+		return results, &RecoverableError{fmt.Sprintf("Commands failed in group %s: %s", group.name, strings.Join(failures, "; "))}
+	}
+	return results, failure
+}
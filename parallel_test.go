@@ -0,0 +1,196 @@
+package cookoo
+
+import (
+	"sync"
+	"testing"
+)
+
+// barrier returns a command that only returns once n commands have reached
+// it, so it fails (by deadlock) unless the commands run at the same time.
+func barrier(n int) Command {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	return func(c Context, p *Params) (interface{}, Interrupt) {
+		wg.Done()
+		wg.Wait()
+		return p.Get("v", nil), nil
+	}
+}
+
+func returns(res interface{}, irq Interrupt) Command {
+	return func(c Context, p *Params) (interface{}, Interrupt) {
+		return res, irq
+	}
+}
+
+func TestParallel(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	wait := barrier(2)
+
+	reg.Route("test", "Test parallel groups").
+		Does(AddToContext, "setup").Using("v").WithDefault(1).
+		Parallel("group", FailOnFatal).
+		Does(wait, "a").Using("v").From("cxt:v").
+		Does(wait, "b").Using("v").WithDefault(2).
+		End().
+		Does(FetchParams, "after").Using("a").From("cxt:a")
+
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if cxt.Get("a", nil) != 1 || cxt.Get("b", nil) != 2 {
+		t.Errorf("! Expected each command's result in the context, got %v and %v", cxt.Get("a", nil), cxt.Get("b", nil))
+	}
+	results, ok := cxt.Get("group", nil).(map[string]interface{})
+	if !ok || len(results) != 2 || results["a"] != 1 || results["b"] != 2 {
+		t.Errorf("! Expected the group to return each result, got %v", cxt.Get("group", nil))
+	}
+	if p := cxt.Get("after", nil).(*Params); p.Get("a", nil) != 1 {
+		t.Error("! Expected commands after the group to see its results.")
+	}
+	if _, ok := cxt.(*synchronizedContext); ok {
+		t.Error("! Expected the route's context to be left as it was.")
+	}
+}
+
+func TestParallelPolicy(t *testing.T) {
+	reg, router, _ := Cookoo()
+
+	for _, policy := range []ParallelPolicy{FailOnFatal, FailOnAny, ContinueOnError} {
+		name := map[ParallelPolicy]string{FailOnFatal: "fatal", FailOnAny: "any", ContinueOnError: "continue"}[policy]
+		reg.Route(name+"-recoverable", "Recoverable error").
+			Parallel("group", policy).
+			Does(returns(nil, &RecoverableError{"Oops"}), "a").
+			Does(returns(true, nil), "b").
+			End().
+			Does(MockCommand, "after")
+		reg.Route(name+"-fatal", "Fatal error").
+			Parallel("group", policy).
+			Does(returns(nil, &FatalError{"Boom"}), "a").
+			Does(returns(true, nil), "b").
+			End().
+			Does(MockCommand, "after")
+	}
+
+	tests := []struct {
+		route string
+		err   string
+	}{
+		{"fatal-recoverable", ""},
+		{"fatal-fatal", "Boom"},
+		{"any-recoverable", "Oops"},
+		{"any-fatal", "Boom"},
+		{"continue-recoverable", ""},
+		{"continue-fatal", ""},
+	}
+	for _, tt := range tests {
+		cxt := NewContext()
+		err := router.HandleRequest(tt.route, cxt, false)
+		if len(tt.err) == 0 && err != nil {
+			t.Errorf("! Route %s: expected no error, got %s", tt.route, err)
+		} else if len(tt.err) > 0 && (err == nil || err.Error() != tt.err) {
+			t.Errorf("! Route %s: expected error %q, got %v", tt.route, tt.err, err)
+		}
+		if cxt.Get("b", nil) != true {
+			t.Errorf("! Route %s: expected every command in the group to finish.", tt.route)
+		}
+		if _, ok := cxt.Has("after"); ok != (err == nil) {
+			t.Errorf("! Route %s: expected the route to go on only without an error.", tt.route)
+		}
+	}
+}
+
+func TestParallelInterrupts(t *testing.T) {
+	reg, router, cxt := Cookoo()
+
+	reg.AddRoute(Route{
+		Name: "test",
+		Does: Tasks{
+			Parallel{
+				Name: "group",
+				Does: Tasks{
+					Cmd{Name: "a", Fn: returns(nil, &FatalError{"Boom"})},
+					Cmd{Name: "b", Fn: returns(nil, &Reroute{"other"})},
+				},
+				Catch: "handler",
+			},
+			Parallel{
+				Name: "second",
+				Does: Tasks{
+					Cmd{Name: "c", Fn: returns(nil, &Stop{})},
+					Cmd{Name: "d", Fn: returns(nil, &Reroute{"other"})},
+				},
+			},
+			Cmd{Name: "after", Fn: MockCommand},
+		},
+	})
+	reg.Route("handler", "Handle errors").Does(FetchParams, "handled").Using("err").From("cxt:error.Command")
+	reg.Route("other", "Reroute target").Does(MockCommand, "other")
+
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := cxt.Get("handled", nil).(*Params); !ok || p.Get("err", nil) != "group" {
+		t.Error("! Expected a failed group to be caught like a command.")
+	}
+	if _, ok := cxt.Has("other"); ok {
+		t.Error("! Expected a failure to take priority over a reroute.")
+	}
+	if _, ok := cxt.Has("after"); ok {
+		t.Error("! Expected the first Stop in the second group to stop the route.")
+	}
+}
+
+func TestParallelTrace(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	router.SetTracer(ContextTracer{})
+
+	reg.Route("test", "Trace a group").
+		Parallel("group", FailOnFatal).
+		Does(MockCommand, "a").
+		Does(MockCommand, "b").
+		End().
+		Does(MockCommand, "c")
+
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := cxt.Get(TraceKey, nil).(*RouteEvent)
+	names := []string{}
+	for _, ev := range trace.Commands {
+		names = append(names, ev.Name)
+	}
+	if len(names) != 4 || names[0] != "group" || names[1] != "a" || names[2] != "b" || names[3] != "c" {
+		t.Errorf("! Expected commands traced in declaration order, got %v", names)
+	}
+}
+
+func TestParallelNeedsCommand(t *testing.T) {
+	reg := NewRegistry()
+	options := map[string]func(){
+		"Using": func() {
+			reg.Route("using", "Using on a group").Parallel("group", FailOnFatal).Using("v")
+		},
+		"UseOnCommand": func() {
+			reg.Route("mw", "Middleware on a group").Parallel("group", FailOnFatal).UseOnCommand(recorder("mw"))
+		},
+		"WithDefault": func() {
+			reg.Route("default", "A default on a group").Parallel("group", FailOnFatal).WithDefault(1)
+		},
+	}
+	for name, fn := range options {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("! Expected %s right after Parallel to panic.", name)
+				}
+			}()
+			fn()
+		}()
+	}
+
+	// Catch applies to the group as a whole.
+	reg.Route("catch", "Catch on a group").Parallel("group", FailOnFatal).Catch("handler").Does(MockCommand, "a").End()
+}
@@ -13,6 +13,11 @@ type Registry struct {
 	routes            map[string]*routeSpec
 	orderedRouteNames []string
 	currentRoute      *routeSpec
+	middleware        []Middleware
+	prefixMiddleware  []*prefixMiddleware
+	openBlocks        []*commandSpec
+	version           uint64
+	aliases           map[string]string
 }
 
 // NewRegistry returns a new initialized registry.
@@ -28,6 +33,7 @@ func (r *Registry) Init() *Registry {
 	// Why 8?
 	r.routes = make(map[string]*routeSpec, 8)
 	r.orderedRouteNames = make([]string, 0, 8)
+	r.version++
 	return r
 }
 
@@ -44,6 +50,10 @@ func (r *Registry) Route(name, description string) *Registry {
 	r.currentRoute = route
 	r.routes[name] = route
 	r.orderedRouteNames = append(r.orderedRouteNames, name)
+	r.version++
+
+	// Any blocks left open on the last route are closed.
+	r.openBlocks = nil
 
 	return r
 }
@@ -52,6 +62,7 @@ func (r *Registry) DoesCmdDef(cd CommandDefinition, name string) *Registry {
 	// Configure command spec.
 	spec := new(commandSpec)
 	spec.name = name
+	spec.def = cd
 	spec.command = func(c Context, p *Params) (interface{}, Interrupt) {
 		// We don't have to clone cmd.Def because Map builds
 		// a new copy.
@@ -63,7 +74,7 @@ func (r *Registry) DoesCmdDef(cd CommandDefinition, name string) *Registry {
 	}
 
 	// Add command spec.
-	r.currentRoute.commands = append(r.currentRoute.commands, spec)
+	r.addCommand(spec)
 
 	return r
 }
@@ -78,16 +89,35 @@ func (r *Registry) Does(cmd Command, commandName string) *Registry {
 	spec.command = cmd
 
 	// Add command spec.
-	r.currentRoute.commands = append(r.currentRoute.commands, spec)
+	r.addCommand(spec)
 
 	return r
 }
 
+// addCommand adds a command to the innermost open block or, if no block is
+// open, to the current route.
+//
+// A parallel group cannot contain a When, Unless, or ForEach block, whether
+// it is opened in the group or copied in by Includes. addCommand panics if
+// one is added.
+func (r *Registry) addCommand(spec *commandSpec) {
+	if n := len(r.openBlocks); n > 0 {
+		block := r.openBlocks[n-1].block
+		if block.kind == parallelBlock && spec.block != nil && spec.block.kind != parallelBlock {
+			panicString := fmt.Sprintf("Group %s cannot contain %s.", r.openBlocks[n-1].name, spec.name)
+			panic(panicString)
+		}
+		block.commands = append(block.commands, spec)
+		return
+	}
+	r.currentRoute.commands = append(r.currentRoute.commands, spec)
+}
+
 // Using specifies a paramater to use for the most recently specified command
 // as set by Does.
 func (r *Registry) Using(name string) *Registry {
 	// Look up the last command added.
-	lastCommand := r.lastCommandAdded()
+	lastCommand := r.lastCommandFor("Using")
 
 	// Create a new spec.
 	spec := new(paramSpec)
@@ -102,7 +132,7 @@ func (r *Registry) Using(name string) *Registry {
 // parameter as set by Using.
 func (r *Registry) WithDefault(value interface{}) *Registry {
 	param := r.lastParamAdded()
-	param.defaultValue = value
+	param.setDefault(value)
 	return r
 }
 
@@ -116,9 +146,62 @@ func (r *Registry) From(fromVal ...string) *Registry {
 	return r
 }
 
+// OnError sets a route to run when a command on the current (most recently
+// specified) route fails.
+//
+// A command fails when it returns a FatalError or any other error. (A
+// RecoverableError, a Stop, or a Reroute is not a failure.) When that
+// happens, the rest of the route is skipped and the handler route is run in
+// its place, using the same context. The context will contain everything the
+// route had produced so far, along with:
+//
+// 	error - the error returned by the failing command
+// 	error.Route - the name of the route that failed
+// 	error.Command - the name of the command that failed
+//
+// If the handler route succeeds, the request succeeds. If the handler fails,
+// its error is returned.
+//
+// 	reg.Route("@fallback", "Report errors").
+// 		Does(ShowError, "show").Using("err").From("cxt:error")
+//
+// 	reg.Route("import", "Import a file").
+// 		OnError("@fallback").
+// 		Does(Open, "file").
+// 		Does(Import, "records")
+//
+// Since handler routes are named in code, they are run untainted, and
+// routes beginning with '@' are allowed.
+func (r *Registry) OnError(route string) *Registry {
+	r.currentRoute.onError = route
+	return r
+}
+
+// Catch sets a route to run when the most recently specified command (as set
+// by Does) fails.
+//
+// Catch provides try/catch semantics for a single command: if the command
+// fails, the handler route is run with the same context values as OnError.
+// If the handler succeeds, the error is considered handled and the chain
+// continues with the next command. If the handler fails, its error is
+// treated as the command's failure, and the route's OnError handler (if any)
+// will then run.
+//
+// Right after Parallel, or after End, Catch applies to the whole block. It
+// cannot follow When, Unless, or ForEach directly, since the block has no
+// command for it yet.
+func (r *Registry) Catch(route string) *Registry {
+	cmd := r.lastCommandAdded()
+	if n := len(r.openBlocks); n > 0 && r.openBlocks[n-1] == cmd && cmd.block.kind != parallelBlock {
+		cmd = r.lastCommandFor("Catch")
+	}
+	cmd.catch = route
+	return r
+}
+
 // Get the last parameter for the last command added.
 func (r *Registry) lastParamAdded() *paramSpec {
-	cspec := r.lastCommandAdded()
+	cspec := r.lastCommandFor("A parameter option")
 	last := len(cspec.parameters) - 1
 	return cspec.parameters[last]
 }
@@ -134,8 +217,9 @@ func (r *Registry) Includes(route string) *Registry {
 		panic(panicString)
 	}
 	for _, cmd := range spec.commands {
-		r.currentRoute.commands = append(r.currentRoute.commands, cmd)
+		r.addCommand(cmd)
 	}
+	r.currentRoute.includes = append(r.currentRoute.includes, route)
 	return r
 }
 
@@ -169,10 +253,40 @@ func (r *Registry) RouteNames() []string {
 	*/
 }
 
+// Version changes whenever a route is added to the registry.
+//
+// Resolvers that compile the route names (like the web package's
+// URIPathResolver) use it to tell when they need to recompile.
+func (r *Registry) Version() uint64 {
+	return r.version
+}
+
 // Look up the last command.
+//
+// Inside of an open block, this is the last command in the block, or the block
+// itself if nothing has been added to it yet.
 func (r *Registry) lastCommandAdded() *commandSpec {
-	lastIndex := len(r.currentRoute.commands) - 1
-	return r.currentRoute.commands[lastIndex]
+	commands := r.currentRoute.commands
+	if n := len(r.openBlocks); n > 0 {
+		commands = r.openBlocks[n-1].block.commands
+		if len(commands) == 0 {
+			return r.openBlocks[n-1]
+		}
+	}
+	lastIndex := len(commands) - 1
+	return commands[lastIndex]
+}
+
+// Look up the last command for a method that only applies to commands.
+//
+// This panics if the last thing added is a block that has no commands yet,
+// since the block would silently ignore whatever the method sets.
+func (r *Registry) lastCommandFor(method string) *commandSpec {
+	cmd := r.lastCommandAdded()
+	if cmd.block != nil {
+		panic(fmt.Sprintf("%s must follow Does, not the start of block %s on route %s.", method, cmd.name, r.currentRoute.name))
+	}
+	return cmd
 }
 
 type RouteDetails interface {
@@ -183,6 +297,9 @@ type RouteDetails interface {
 type routeSpec struct {
 	name, description string
 	commands          []*commandSpec
+	middleware        []Middleware
+	onError           string
+	includes          []string
 }
 
 func (r *routeSpec) Name() string {
@@ -197,12 +314,47 @@ type commandSpec struct {
 	name       string
 	command    Command
 	parameters []*paramSpec
+	middleware []Middleware
+	catch      string
+	def        CommandDefinition
+	block      *blockSpec
 }
 
+// blockSpec describes a group of commands that run together, such as a
+// Parallel group or a When block. A commandSpec with a block has no command
+// of its own.
+type blockSpec struct {
+	kind     blockKind
+	commands []*commandSpec
+	policy   ParallelPolicy
+	cond     func(Context) bool
+	over     string
+}
+
+type blockKind int
+
+const (
+	parallelBlock blockKind = iota
+	whenBlock
+	forEachBlock
+)
+
 type paramSpec struct {
 	name         string
 	defaultValue interface{}
 	from         string
+	typ          string
+}
+
+// setDefault sets the default value, along with the type if the value was
+// made by Typed.
+func (p *paramSpec) setDefault(value interface{}) {
+	if td, ok := value.(typedDefault); ok {
+		mustBeParamType(td.typ)
+		p.typ = td.typ
+		value = td.val
+	}
+	p.defaultValue = value
 }
 
 // New public API
@@ -219,73 +371,181 @@ func extractParams(cmd Task) []*paramSpec {
 	paramspecs = make([]*paramSpec, len(cmd.getParams()))
 	for j, prm := range cmd.getParams() {
 		pspec := &paramSpec{
-			name:         prm.Name,
-			defaultValue: prm.DefaultValue,
-			from:         prm.From,
+			name: prm.Name,
+			from: prm.From,
 		}
+		pspec.setDefault(prm.DefaultValue)
 		paramspecs[j] = pspec
 	}
 	return paramspecs
 }
 
 // AddRoutes adds one or more routes to the registry.
+//
+// A route may include the routes before it. If any route fails to compile,
+// for example because it includes a route that does not exist, none of the
+// routes are added, and the registry is left as it was.
 func (r *Registry) AddRoutes(routes ...Route) error {
+	undo := r.undoAdd()
 	for _, route := range routes {
 
-		cmdspecs := make([]*commandSpec, 0, len(route.Does))
-		for _, cmd := range route.Does {
-			switch cmd := cmd.(type) {
-			case CmdDef:
-				// This wraps the CmdDef inside of a command.
-				paramspecs := extractParams(cmd)
-				cmdspec := &commandSpec{
-					name: cmd.Name,
-					command: func(c Context, p *Params) (interface{}, Interrupt) {
-						// We don't have to clone cmd.Def because Map builds
-						// a new copy.
-						o, err := Map(c, p, cmd.Def)
-						if err != nil {
-							return nil, err
-						}
-						return o.Run(c)
-					},
-					parameters: paramspecs,
-				}
-				cmdspecs = append(cmdspecs, cmdspec)
-
-			case Cmd:
-				paramspecs := extractParams(cmd)
-
-				cmdspec := &commandSpec{
-					name:       cmd.Name,
-					command:    cmd.Fn,
-					parameters: paramspecs,
-				}
-				cmdspecs = append(cmdspecs, cmdspec)
-			case Include:
-				other, ok := r.RouteSpec(cmd.Path)
-				if !ok {
-					// Route not found.
-					return fmt.Errorf("Route '%s' not found.", cmd.Path)
-				}
-				cmdspecs = append(cmdspecs, other.commands...)
-
-			}
+		includes := []string{}
+		cmdspecs, err := r.compileTasks(route.Does, &includes)
+		if err != nil {
+			undo()
+			return err
 		}
 
 		rspec := &routeSpec{
 			name:        route.Name,
 			description: route.Help,
 			commands:    cmdspecs,
+			middleware:  route.Use,
+			onError:     route.OnError,
+			includes:    includes,
 		}
 		// Add the route spec.
 		r.currentRoute = rspec
 		r.routes[rspec.name] = rspec
 		r.orderedRouteNames = append(r.orderedRouteNames, rspec.name)
+		r.version++
+		r.openBlocks = nil
+		if len(route.Alias) > 0 {
+			if err := r.setAlias(route.Alias, route.Name); err != nil {
+				undo()
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// undoAdd returns a function that puts the routes and aliases back the way
+// they are now. The version is not put back, so anything that has seen the
+// routes in between knows to look again.
+func (r *Registry) undoAdd() func() {
+	routes := make(map[string]*routeSpec, len(r.routes))
+	for k, v := range r.routes {
+		routes[k] = v
+	}
+	aliases := make(map[string]string, len(r.aliases))
+	for k, v := range r.aliases {
+		aliases[k] = v
+	}
+	names := len(r.orderedRouteNames)
+	current, blocks := r.currentRoute, r.openBlocks
+	return func() {
+		r.routes = routes
+		r.aliases = aliases
+		r.orderedRouteNames = r.orderedRouteNames[:names]
+		r.currentRoute, r.openBlocks = current, blocks
+		r.version++
+	}
+}
+
+// compileTasks turns Tasks into command specs. The names of any included
+// routes are appended to includes.
+func (r *Registry) compileTasks(tasks Tasks, includes *[]string) ([]*commandSpec, error) {
+	cmdspecs := make([]*commandSpec, 0, len(tasks))
+	for _, cmd := range tasks {
+		switch cmd := cmd.(type) {
+		case CmdDef:
+			// This wraps the CmdDef inside of a command.
+			paramspecs := extractParams(cmd)
+			cmdspec := &commandSpec{
+				name: cmd.Name,
+				command: func(c Context, p *Params) (interface{}, Interrupt) {
+					// We don't have to clone cmd.Def because Map builds
+					// a new copy.
+					o, err := Map(c, p, cmd.Def)
+					if err != nil {
+						return nil, err
+					}
+					return o.Run(c)
+				},
+				parameters: paramspecs,
+				middleware: cmd.Use,
+				catch:      cmd.Catch,
+				def:        cmd.Def,
+			}
+			cmdspecs = append(cmdspecs, cmdspec)
+
+		case Cmd:
+			paramspecs := extractParams(cmd)
+
+			cmdspec := &commandSpec{
+				name:       cmd.Name,
+				command:    cmd.Fn,
+				parameters: paramspecs,
+				middleware: cmd.Use,
+				catch:      cmd.Catch,
+			}
+			cmdspecs = append(cmdspecs, cmdspec)
+		case Include:
+			other, ok := r.RouteSpec(cmd.Path)
+			if !ok {
+				// Route not found.
+				return nil, fmt.Errorf("Route '%s' not found.", cmd.Path)
+			}
+			cmdspecs = append(cmdspecs, other.commands...)
+			*includes = append(*includes, cmd.Path)
+
+		case Parallel:
+			children, err := r.compileTasks(cmd.Does, includes)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				if child.block != nil && child.block.kind != parallelBlock {
+					return nil, fmt.Errorf("Group '%s' cannot contain '%s'.", cmd.Name, child.name)
+				}
+			}
+			cmdspec := &commandSpec{
+				name:  cmd.Name,
+				catch: cmd.Catch,
+				block: &blockSpec{commands: children, policy: cmd.Policy},
+			}
+			cmdspecs = append(cmdspecs, cmdspec)
+
+		case When, Unless, ForEach:
+			cmdspec, err := r.compileControl(cmd, includes)
+			if err != nil {
+				return nil, err
+			}
+			cmdspecs = append(cmdspecs, cmdspec)
+		}
+	}
+	return cmdspecs, nil
+}
+
+// compileControl compiles a When, Unless, or ForEach.
+func (r *Registry) compileControl(task Task, includes *[]string) (*commandSpec, error) {
+	var spec *commandSpec
+	var tasks Tasks
+	var err error
+	switch task := task.(type) {
+	case When:
+		spec, err = whenSpec("when", task.Cond, false)
+		tasks = task.Does
+	case Unless:
+		spec, err = whenSpec("unless", task.Cond, true)
+		tasks = task.Does
+	case ForEach:
+		spec = forEachSpec(task.In)
+		tasks = task.Does
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := r.compileTasks(tasks, includes)
+	if err != nil {
+		return nil, err
+	}
+	spec.block.commands = children
+	return spec, nil
+}
+
 // Route declares a new Cookoo route.
 //
 // A Route has a name, which is used to identify and call it, and Help. The
@@ -294,15 +554,27 @@ func (r *Registry) AddRoutes(routes ...Route) error {
 //
 // Routes are composed of a series of Tasks, each of which is executed in
 // order.
+//
+// Use lists Middleware that wraps every command on the route.
+//
+// OnError names a route to run if a command on this route fails. See
+// Registry.OnError.
+//
+// Alias gives the route another name for building URLs. See Registry.Alias.
 type Route struct {
 	Name, Help string
 	Does       Tasks
+	Use        []Middleware
+	OnError    string
+	Alias      string
 }
 
 // Tasks represents a list of discrete tasks that are run on a Route.
 //
-// There are two kinds of Tasks: Cmd (a command) and Include, which imports a
-// Tasks list from another route.
+// The basic kinds of Tasks are Cmd (a command) and Include, which imports a
+// Tasks list from another route. Parallel groups Tasks that run at the same
+// time, When and Unless run Tasks only under a condition, and ForEach runs
+// Tasks once for each item in a list.
 type Tasks []Task
 
 // Cmd associates a cookoo.Command to a Route.
@@ -314,10 +586,16 @@ type Tasks []Task
 //
 // Using contains a list of Parameters that Cookoo can pass into the Command
 // at execution time.
+//
+// Use lists Middleware that wraps this command.
+//
+// Catch names a route to run if this command fails. See Registry.Catch.
 type Cmd struct {
 	Name  string
 	Fn    Command
 	Using Parameters
+	Use   []Middleware
+	Catch string
 }
 
 // Include imports all of the Tasks on another route into the present Route.
@@ -329,6 +607,8 @@ type CmdDef struct {
 	Name  string
 	Def   CommandDefinition
 	Using Parameters
+	Use   []Middleware
+	Catch string
 }
 
 // A Task can be either an Include or a Cmd. This is a very lame way of
@@ -356,6 +636,7 @@ type Parameters []Param
 // Names it uses.
 //
 // The DefaultValue is the value of the Parameter if nothing else is specified.
+// To declare the Parameter's type, wrap the default with Typed.
 //
 // From indicates where the Param value may come from. Examples: `From("cxt:foo")`
 // gets the value from the value of the key 'foo' in the Context.
@@ -186,6 +186,11 @@ func TestRouteNames(t *testing.T) {
 		}
 	}
 
+	v := reg.Version()
+	reg.Route("six", "A route")
+	if reg.Version() == v {
+		t.Error("! Expected the version to change when a route is added.")
+	}
 }
 
 func TestAddRoutes(t *testing.T) {
@@ -285,3 +290,31 @@ func TestAddRoutes(t *testing.T) {
 		t.Error("Expected cxt:test, got %s", param.from)
 	}
 }
+
+func TestAddRoutesFails(t *testing.T) {
+	reg := NewRegistry()
+	reg.Route("old", "Already here").Does(AnotherCommand, "a")
+	version := reg.Version()
+
+	// The second route cannot be compiled, so neither is added.
+	err := reg.AddRoutes(
+		Route{Name: "first", Alias: "one", Does: Tasks{Cmd{Name: "cmd1", Fn: AnotherCommand}}},
+		Route{Name: "old", Does: Tasks{Cmd{Name: "cmd2", Fn: AnotherCommand}}},
+		Route{Name: "second", Does: Tasks{Include{"first"}, Include{"nope"}}},
+	)
+	if err == nil {
+		t.Fatal("! Expected an error for a missing include.")
+	}
+	if names := reg.RouteNames(); len(names) != 1 || names[0] != "old" {
+		t.Errorf("! Expected only the old route, got %v", names)
+	}
+	if spec, _ := reg.RouteSpec("old"); spec.commands[0].name != "a" {
+		t.Error("! Expected the old route to be put back.")
+	}
+	if _, ok := reg.RouteForAlias("one"); ok {
+		t.Error("! Expected the alias to be removed.")
+	}
+	if reg.Version() == version {
+		t.Error("! Expected the version to change.")
+	}
+}
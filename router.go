@@ -3,6 +3,7 @@ package cookoo
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // RequestResolver is the interface for the request resolver.
@@ -20,10 +21,16 @@ type RequestResolver interface {
 // relying on the router to execute the appropriate chain of
 // commands.
 type Router struct {
-	registry *Registry
-	resolver RequestResolver
+	registry    *Registry
+	resolver    RequestResolver
+	tracers     []Tracer
+	maxReroutes int
 }
 
+// DefaultMaxReroutes is the default limit on how many times a single request
+// may be rerouted. See Router.SetMaxReroutes.
+const DefaultMaxReroutes = 32
+
 // BasicRequestResolver is a basic resolver that assumes that the given request
 // name *is* the route name.
 type BasicRequestResolver struct {
@@ -52,6 +59,7 @@ func (r *BasicRequestResolver) Resolve(path string, cxt Context) (string, error)
 // Init initializes the Router.
 func (r *Router) Init(registry *Registry) *Router {
 	r.registry = registry
+	r.maxReroutes = DefaultMaxReroutes
 	r.resolver = new(BasicRequestResolver)
 	r.resolver.Init(registry)
 	return r
@@ -76,6 +84,44 @@ func (r *Router) RequestResolver() RequestResolver {
 	return r.resolver
 }
 
+// SetMaxReroutes sets how many times a single request may be rerouted.
+//
+// Each Reroute, and each error handler that is run, counts as one hop. When a
+// request goes over the limit, a RouteError is returned instead of running
+// the next route. This keeps a chain of routes that keep rerouting from
+// running forever.
+func (r *Router) SetMaxReroutes(max int) {
+	r.maxReroutes = max
+}
+
+// MaxReroutes returns how many times a single request may be rerouted.
+func (r *Router) MaxReroutes() int {
+	return r.maxReroutes
+}
+
+// SetTracer sets the Tracer that receives execution events.
+//
+// This replaces any tracers already set on the router. Passing nil turns
+// tracing off.
+func (r *Router) SetTracer(t Tracer) {
+	r.tracers = nil
+	if t != nil {
+		r.tracers = []Tracer{t}
+	}
+}
+
+// AddTracer adds a Tracer to those already receiving execution events.
+//
+// Tracers receive events in the order they were added.
+func (r *Router) AddTracer(t Tracer) {
+	r.tracers = append(r.tracers, t)
+}
+
+// Tracers returns the tracers that receive execution events.
+func (r *Router) Tracers() []Tracer {
+	return r.tracers
+}
+
 // ResolveRequest resolver a given string into a route name.
 func (r *Router) ResolveRequest(name string, cxt Context) (string, error) {
 	routeName, e := r.resolver.Resolve(name, cxt)
@@ -107,6 +153,23 @@ func (r *Router) ResolveRequest(name string, cxt Context) (string, error) {
 // 	route.Description - Description of the current route
 // 	route.RequestName - raw route name as passed by the client
 // 	command.Name - current command name (changed with each command)
+// 	route.History - a []string of every route run so far for this request,
+// 	  starting with the requested route (changed with each reroute)
+//
+// A route that reroutes back to a route that led to it is a loop. Rather
+// than run it, the router returns a RouteError showing the reroute path. The
+// same happens when a request is rerouted more times than MaxReroutes.
+//
+// When a command fails, the route's error handler (see Registry.OnError and
+// Registry.Catch) may run. In that case, these are also set:
+//
+// 	error - the error returned by the failing command
+// 	error.Route - the name of the route that failed
+// 	error.Command - the name of the command that failed
+//
+// If a context.Context has been attached to cxt (see SetStdContext), it is
+// checked before each command runs. Once it is canceled or its deadline
+// passes, no further commands are run and a *Canceled is returned.
 //
 // If an error occurred during processing, an error type is returned.
 func (r *Router) HandleRequest(name string, cxt Context, taint bool) error {
@@ -117,6 +180,7 @@ func (r *Router) HandleRequest(name string, cxt Context, taint bool) error {
 	routeName, e := r.ResolveRequest(name, cxt)
 
 	if e != nil {
+		r.traceRequestError(cxt, name, e)
 		return e
 	}
 
@@ -128,7 +192,7 @@ func (r *Router) HandleRequest(name string, cxt Context, taint bool) error {
 
 	// Let an outer routine call go HandleRequest()
 	//go r.runRoute(routeName, cxt, taint)
-	e = r.runRoute(routeName, cxt, taint)
+	e = r.runRoute(routeName, cxt, taint, nil)
 
 	return e
 }
@@ -144,74 +208,245 @@ func (r *Router) HasRoute(name string) bool {
 // PRIVATE ==========================================================
 
 // Given a router, context, and taint, run the route.
-func (r *Router) runRoute(route string, cxt Context, taint bool) error {
+//
+// The parent is the command that caused this route to run, or nil if this is
+// the route that was requested.
+func (r *Router) runRoute(route string, cxt Context, taint bool, parent *CommandEvent) error {
+	spec, e := r.findRoute(route, taint)
+	if e == nil {
+		e = r.checkReroute(route, parent)
+	}
+	if e != nil {
+		// A rerouted route's error goes to the route that rerouted.
+		if parent == nil {
+			r.traceRequestError(cxt, route, e)
+		}
+		return e
+	}
+	history := []string{}
+	if parent != nil {
+		history = append(history, cxt.Get("route.History", []string{}).([]string)...)
+	}
+	cxt.Put("route.History", append(history, route))
+
+	ev := &RouteEvent{Name: spec.name, Parent: parent, Start: time.Now()}
+	if parent != nil {
+		parent.Routes = append(parent.Routes, ev)
+	}
+	r.traceRouteStart(cxt, ev)
+	defer r.endRouteOnPanic(cxt, ev)
+
+	err := r.runCommands(spec, ev, cxt)
+
+	ev.Duration = time.Since(ev.Start)
+	ev.Err = err
+	r.traceRouteEnd(cxt, ev)
+	return err
+}
+
+// findRoute looks up a route that is about to run.
+func (r *Router) findRoute(route string, taint bool) (*routeSpec, error) {
 	if len(route) == 0 {
-		return &RouteError{"Empty route name."}
+		return nil, &RouteError{"Empty route name."}
 	}
 	if taint && route[0] == '@' {
-		return &RouteError{"Route is tainted. Refusing to run."}
+		return nil, &RouteError{"Route is tainted. Refusing to run."}
 	}
 	spec, ok := r.registry.RouteSpec(route)
 	if !ok {
-		return &RouteError{fmt.Sprintf("Route %s does not exist.", route)}
+		return nil, &RouteError{fmt.Sprintf("Route %s does not exist.", route)}
+	}
+	return spec, nil
+}
+
+// checkReroute refuses to run a route that loops back on the routes that led
+// to it, or that goes past the maximum number of reroutes.
+func (r *Router) checkReroute(route string, parent *CommandEvent) error {
+	if parent == nil {
+		return nil
+	}
+	// Walk back up to the requested route.
+	path := []string{route}
+	loop := false
+	for p := parent; p != nil; p = p.Route.Parent {
+		path = append(path, p.Route.Name)
+		if p.Route.Name == route {
+			loop = true
+		}
 	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	if loop {
+		return &RouteError{fmt.Sprintf("Reroute loop: %s", strings.Join(path, " -> "))}
+	}
+	if len(path)-1 > r.maxReroutes {
+		return &RouteError{fmt.Sprintf("Too many reroutes (max %d): %s", r.maxReroutes, strings.Join(path, " -> "))}
+	}
+	return nil
+}
+
+// Run each command on a route, handling interrupts as they come.
+func (r *Router) runCommands(spec *routeSpec, rev *RouteEvent, cxt Context) error {
+	_, err := r.runChain(spec, spec.commands, rev, cxt)
+	return err
+}
+
+// Run a chain of commands on a route.
+//
+// If done is true, the route is over, either because a command ended it (or
+// failed), or because another route took over.
+func (r *Router) runChain(spec *routeSpec, cmds []*commandSpec, rev *RouteEvent, cxt Context) (done bool, err error) {
+	route := spec.name
 	// fmt.Printf("Running route %s: %s\n", spec.name, spec.description)
-	for _, cmd := range spec.commands {
+	for _, cmd := range cmds {
+		// Do not start another command once the request is canceled.
+		if err := StdContext(cxt).Err(); err != nil {
+			return true, &Canceled{route, err}
+		}
+
+		// Conditions and loops run their commands as part of this chain.
+		if cmd.block != nil && cmd.block.kind != parallelBlock {
+			if done, err := r.runControl(spec, cmd, rev, cxt); done {
+				return true, err
+			}
+			continue
+		}
+
 		// Provide info for each run.
 		cxt.Put("command.Name", cmd.name)
 
 		// fmt.Printf("Command %d is %s (%T)\n", i, cmd.name, cmd.command)
-		res, irq := r.doCommand(cmd, cxt)
+		ev := &CommandEvent{Name: cmd.name, Route: rev}
+		rev.Commands = append(rev.Commands, ev)
+		res, irq := r.doCommand(spec, cmd, ev, cxt)
 
 		// This may store a nil.
 		cxt.Put(cmd.name, res)
 
 		// Handle interrupts.
 		if irq != nil {
-			// If this is a reroute, call runRoute() again.
-			reroute, isType := irq.(*Reroute)
-			if isType {
-				routeName, e := r.ResolveRequest(reroute.RouteTo(), cxt)
-				if e != nil {
-					return e
-				}
-				//fmt.Printf("Routing to %s\n", routeName)
-				// MPB: I think re-routes should disable taint mode, since they
-				// are explicitly called from within the code.
-				return r.runRoute(routeName, cxt /*taint*/, false)
+			if done, err := r.handleInterrupt(spec, cmd, ev, irq, cxt); done {
+				return true, err
 			}
+		}
+	}
+	return false, nil
+}
 
-			_, isType = irq.(*Stop)
-			if isType {
-				return nil
-			}
+// Handle an interrupt returned by a command.
+//
+// If done is false, the route goes on with its next command.
+func (r *Router) handleInterrupt(spec *routeSpec, cmd *commandSpec, ev *CommandEvent, irq Interrupt, cxt Context) (done bool, err error) {
+	route := spec.name
+
+	// If this is a reroute, call runRoute() again.
+	reroute, isType := irq.(*Reroute)
+	if isType {
+		routeName, e := r.ResolveRequest(reroute.RouteTo(), cxt)
+		if e != nil {
+			return true, e
+		}
+		//fmt.Printf("Routing to %s\n", routeName)
+		// MPB: I think re-routes should disable taint mode, since they
+		// are explicitly called from within the code.
+		return true, r.runRoute(routeName, cxt /*taint*/, false, ev)
+	}
 
-			// If this is a recoverable error, recover and go on.
-			err, isType := irq.(*RecoverableError)
-			// Otherwise, terminate the route.
-			if isType {
-				// Swallow the error.
-				// XXX: Should this be logged?
-				cxt.Logf("warn", "Continuing after Recoverable Error on route %s: %v", route, err)
-			} else {
-				// return irq.(*FatalError)
-				return irq.(error)
-			}
+	_, isType = irq.(*Stop)
+	if isType {
+		return true, nil
+	}
+
+	// If this is a recoverable error, recover and go on.
+	recoverable, isType := irq.(*RecoverableError)
+	// Otherwise, terminate the route.
+	if isType {
+		// Swallow the error.
+		// XXX: Should this be logged?
+		cxt.Logf("warn", "Continuing after Recoverable Error on route %s: %v", route, recoverable)
+		return false, nil
+	}
+
+	// return irq.(*FatalError)
+	failure := irq.(error)
+	if _, isType := failure.(*Canceled); isType {
+		return true, failure
+	}
+
+	// A command-level handler recovers, and the chain goes on.
+	if len(cmd.catch) > 0 {
+		failure = r.runErrorHandler(cmd.catch, route, cmd.name, failure, ev, cxt)
+		if failure == nil {
+			return false, nil
 		}
 	}
-	return nil
+
+	// A route-level handler replaces the rest of the route.
+	if len(spec.onError) > 0 {
+		return true, r.runErrorHandler(spec.onError, route, cmd.name, failure, ev, cxt)
+	}
+	return true, failure
 }
 
-// Do an individual command.
-func (r *Router) doCommand(cmd *commandSpec, cxt Context) (interface{}, Interrupt) {
-	params := r.resolveParams(cmd, cxt)
+// runErrorHandler runs an error handling route after a command fails.
+//
+// The failing route, command, and error are placed into the context so that
+// the handler can inspect them alongside whatever the route had already put
+// into the context.
+func (r *Router) runErrorHandler(handler, route, command string, failure error, parent *CommandEvent, cxt Context) error {
+	cxt.Put("error", failure)
+	cxt.Put("error.Route", route)
+	cxt.Put("error.Command", command)
+
+	routeName, e := r.ResolveRequest(handler, cxt)
+	if e != nil {
+		return e
+	}
+	// Like reroutes, handlers are named in code, so taint does not apply.
+	return r.runRoute(routeName, cxt, false, parent)
+}
 
-	ret, irq := cmd.command(cxt, params)
+// Do an individual command, wrapped in any middleware that applies to it.
+func (r *Router) doCommand(route *routeSpec, cmd *commandSpec, ev *CommandEvent, cxt Context) (interface{}, Interrupt) {
+	if cmd.block != nil {
+		return r.runBlock(route, cmd, r.prepareBlock(route, cmd, ev.Route, cxt), ev, cxt)
+	}
+	params, err := r.resolveParams(route, cmd, cxt)
+	return r.callCommand(route, cmd, params, err, ev, cxt)
+}
+
+// Call a command with already resolved params.
+//
+// If the params could not be resolved, the command is skipped, and the error
+// is returned as its interrupt.
+func (r *Router) callCommand(route *routeSpec, cmd *commandSpec, params *Params, paramErr error, ev *CommandEvent, cxt Context) (interface{}, Interrupt) {
+	ev.Params = params
+	ev.Start = time.Now()
+	r.traceCommandStart(cxt, ev)
+	defer r.endCommandOnPanic(cxt, ev)
+
+	var ret interface{}
+	var irq Interrupt
+	if paramErr != nil {
+		irq = paramErr
+	} else {
+		ret, irq = r.registry.wrapCommand(route, cmd)(cxt, params)
+	}
+
+	ev.Duration = time.Since(ev.Start)
+	ev.Result = ret
+	ev.Interrupt = irq
+	r.traceCommandEnd(cxt, ev)
 	return ret, irq
 }
 
 // Get the appropriate values for each param.
-func (r *Router) resolveParams(cmd *commandSpec, cxt Context) *Params {
+//
+// Params with a type are converted to it. If that fails, the error is a
+// *ParamError, and the params are returned as far as they got.
+func (r *Router) resolveParams(route *routeSpec, cmd *commandSpec, cxt Context) (*Params, error) {
 	parameters := NewParams(len(cmd.parameters))
 	for _, ps := range cmd.parameters {
 		sources := parseFromStatement(ps.from)
@@ -220,9 +455,23 @@ func (r *Router) resolveParams(cmd *commandSpec, cxt Context) *Params {
 			parameters.set(ps.name, ps.defaultValue)
 			val = ps.defaultValue
 		}
+		if len(ps.typ) > 0 {
+			typed, err := Coerce(val, ps.typ)
+			if err != nil {
+				return parameters, &ParamError{
+					Route:   route.name,
+					Command: cmd.name,
+					Param:   ps.name,
+					Type:    ps.typ,
+					Value:   val,
+					Err:     err,
+				}
+			}
+			val = typed
+		}
 		parameters.set(ps.name, val)
 	}
-	return parameters
+	return parameters, nil
 }
 
 // Get the values from a source.
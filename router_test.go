@@ -1,7 +1,9 @@
 package cookoo
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 // Mock resolver
@@ -383,8 +385,8 @@ func TestHandleRequest(t *testing.T) {
 
 	context = NewContext()
 	router.HandleRequest("Several", context, false)
-	if context.Len() != 7 {
-		t.Errorf("! Expected three items in the context, got %d", context.Len())
+	if context.Len() != 8 {
+		t.Errorf("! Expected eight items in the context, got %d", context.Len())
 	}
 
 	e = router.HandleRequest("", context, true)
@@ -461,8 +463,8 @@ func TestHandleRequestCmdDef(t *testing.T) {
 
 	context = NewContext()
 	router.HandleRequest("Several", context, false)
-	if context.Len() != 7 {
-		t.Errorf("! Expected three items in the context, got %d", context.Len())
+	if context.Len() != 8 {
+		t.Errorf("! Expected eight items in the context, got %d", context.Len())
 	}
 
 	e = router.HandleRequest("", context, true)
@@ -552,3 +554,198 @@ func TestStop(t *testing.T) {
 		t.Error("! Expected fake2 to not get executed.")
 	}
 }
+
+func TestCanceled(t *testing.T) {
+	reg, router, cxt := Cookoo()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	SetStdContext(cxt, ctx)
+
+	reg.Route("TEST", "A test route").
+		Does(MockCommand, "first").
+		Does(func(c Context, p *Params) (interface{}, Interrupt) {
+			cancel()
+			return true, nil
+		}, "cancel").
+		Does(MockCommand, "third")
+
+	e := router.HandleRequest("TEST", cxt, false)
+	irq, ok := e.(*Canceled)
+	if !ok {
+		t.Fatalf("! Expected a *Canceled, got %T", e)
+	}
+	if irq.Route != "TEST" {
+		t.Errorf("! Expected route TEST, got %s", irq.Route)
+	}
+	if irq.Err != context.Canceled {
+		t.Errorf("! Expected context.Canceled, got %v", irq.Err)
+	}
+	if _, ok := cxt.Has("first"); !ok {
+		t.Error("! Expected first to run.")
+	}
+	if _, ok := cxt.Has("third"); ok {
+		t.Error("! Expected third to not run after cancellation.")
+	}
+
+	// A context that is already past its deadline never runs a command.
+	cxt = NewContext()
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	SetStdContext(cxt, ctx)
+	e = router.HandleRequest("TEST", cxt, false)
+	if irq, ok := e.(*Canceled); !ok || irq.Err != context.DeadlineExceeded {
+		t.Errorf("! Expected a deadline error, got %v", e)
+	}
+	if _, ok := cxt.Has("first"); ok {
+		t.Error("! Expected first to not run.")
+	}
+}
+
+func TestOnError(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.
+		Route("@fallback", "Handle errors").
+		Does(AddToContext, "handled").Using("handler").WithDefault("@fallback").
+		Route("TEST", "A test route").
+		OnError("@fallback").
+		Does(AddToContext, "first").Using("partial").WithDefault(true).
+		Does(FatalErrorCommand, "fail").
+		Does(FetchParams, "never")
+
+	e := router.HandleRequest("TEST", cxt, false)
+	if e != nil {
+		t.Errorf("! Expected handler to handle the error, got %s", e)
+	}
+	if _, ok := cxt.Has("handled"); !ok {
+		t.Error("! Expected the error handler to run.")
+	}
+	if _, ok := cxt.Has("never"); ok {
+		t.Error("! Expected the route to stop at the failing command.")
+	}
+	if cxt.Get("partial", false) != true {
+		t.Error("! Expected partial context to be preserved.")
+	}
+	if err, ok := cxt.Get("error", nil).(*FatalError); !ok || err.Message != "Blarg" {
+		t.Errorf("! Expected the failure in the context, got %v", cxt.Get("error", nil))
+	}
+	if n := cxt.Get("error.Command", "").(string); n != "fail" {
+		t.Errorf("! Expected error.Command to be fail, got %s", n)
+	}
+	if n := cxt.Get("error.Route", "").(string); n != "TEST" {
+		t.Errorf("! Expected error.Route to be TEST, got %s", n)
+	}
+
+	// A failing handler passes its error back.
+	reg.Route("@broken", "Fails to handle").Does(FatalErrorCommand, "again").
+		Route("TEST2", "Another test").OnError("@broken").Does(FatalErrorCommand, "fail")
+	if e := router.HandleRequest("TEST2", NewContext(), false); e == nil {
+		t.Error("! Expected error from failing handler.")
+	}
+}
+
+func TestCatch(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.AddRoutes(
+		Route{
+			Name: "@recover",
+			Does: Tasks{Cmd{Name: "recovered", Fn: MockCommand}},
+		},
+		Route{
+			Name: "@fail",
+			Does: Tasks{Cmd{Name: "nope", Fn: FatalErrorCommand}},
+		},
+		Route{
+			Name: "@fallback",
+			Does: Tasks{Cmd{Name: "fallback", Fn: MockCommand}},
+		},
+		Route{
+			Name:    "TEST",
+			OnError: "@fallback",
+			Does: Tasks{
+				Cmd{Name: "first", Fn: FatalErrorCommand, Catch: "@recover"},
+				Cmd{Name: "second", Fn: MockCommand},
+				Cmd{Name: "third", Fn: FatalErrorCommand, Catch: "@fail"},
+				Cmd{Name: "fourth", Fn: MockCommand},
+			},
+		},
+	)
+
+	if e := router.HandleRequest("TEST", cxt, false); e != nil {
+		t.Errorf("! Unexpected error: %s", e)
+	}
+	if _, ok := cxt.Has("recovered"); !ok {
+		t.Error("! Expected catch route to run.")
+	}
+	if _, ok := cxt.Has("second"); !ok {
+		t.Error("! Expected chain to continue after a caught error.")
+	}
+	if _, ok := cxt.Has("fourth"); ok {
+		t.Error("! Expected chain to stop when the catch route fails.")
+	}
+	if _, ok := cxt.Has("fallback"); !ok {
+		t.Error("! Expected route handler to run when catch route fails.")
+	}
+	if n := cxt.Get("error.Command", "").(string); n != "third" {
+		t.Errorf("! Expected error.Command to be third, got %s", n)
+	}
+}
+
+func TestRerouteLoop(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.
+		Route("A", "Loops to B").Does(RerouteCommand, "toB").Using("route").WithDefault("B").
+		Route("B", "Loops to C").Does(RerouteCommand, "toC").Using("route").WithDefault("C").
+		Route("C", "Loops to A").Does(RerouteCommand, "toA").Using("route").WithDefault("A")
+
+	e := router.HandleRequest("A", cxt, false)
+	if _, ok := e.(*RouteError); !ok {
+		t.Fatalf("! Expected a RouteError, got %v", e)
+	}
+	if e.Error() != "Reroute loop: A -> B -> C -> A" {
+		t.Errorf("! Unexpected message: %s", e)
+	}
+
+	history := cxt.Get("route.History", nil).([]string)
+	if len(history) != 3 || history[0] != "A" || history[2] != "C" {
+		t.Errorf("! Unexpected history %v", history)
+	}
+
+	// A new request starts a new history.
+	reg.Route("D", "No reroutes").Does(MockCommand, "d")
+	if e := router.HandleRequest("D", cxt, false); e != nil {
+		t.Fatal(e)
+	}
+	if history := cxt.Get("route.History", nil).([]string); len(history) != 1 {
+		t.Errorf("! Expected fresh history, got %v", history)
+	}
+}
+
+func TestMaxReroutes(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.
+		Route("one", "").Does(RerouteCommand, "fwd").Using("route").WithDefault("two").
+		Route("two", "").Does(RerouteCommand, "fwd").Using("route").WithDefault("three").
+		Route("three", "").Does(MockCommand, "done")
+
+	if router.MaxReroutes() != DefaultMaxReroutes {
+		t.Errorf("! Expected default max of %d", DefaultMaxReroutes)
+	}
+	router.SetMaxReroutes(1)
+
+	e := router.HandleRequest("one", cxt, false)
+	if e == nil || e.Error() != "Too many reroutes (max 1): one -> two -> three" {
+		t.Errorf("! Expected too many reroutes, got %v", e)
+	}
+	if _, ok := cxt.Has("done"); ok {
+		t.Error("! Expected route three to not run.")
+	}
+
+	router.SetMaxReroutes(2)
+	if e := router.HandleRequest("one", cxt, false); e != nil {
+		t.Errorf("! Unexpected error: %s", e)
+	}
+	history := cxt.Get("route.History", nil).([]string)
+	if len(history) != 3 {
+		t.Errorf("! Expected three routes in history, got %v", history)
+	}
+}
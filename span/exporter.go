@@ -0,0 +1,220 @@
+package span
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans somewhere.
+//
+// A Tracer calls ExportSpans from a goroutine of its own, with the spans of
+// one or more requests. An exporter shared by several Tracers may be called
+// from several goroutines at once.
+type Exporter interface {
+	ExportSpans(spans []*Span) error
+}
+
+// MemoryExporter keeps spans in memory. It is meant for tests.
+type MemoryExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+// ExportSpans stores the spans.
+func (m *MemoryExporter) ExportSpans(spans []*Span) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (m *MemoryExporter) Spans() []*Span {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]*Span{}, m.spans...)
+}
+
+// Reset forgets the spans exported so far.
+func (m *MemoryExporter) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.spans = nil
+}
+
+// ScopeName is the instrumentation scope reported by the OTLPExporter.
+const ScopeName = "github.com/Masterminds/cookoo"
+
+// OTLPExporter sends spans to an OpenTelemetry collector, using OTLP over
+// HTTP with JSON encoding.
+//
+// URL is the collector's traces endpoint, usually
+// http://localhost:4318/v1/traces. ServiceName is reported as the
+// service.name resource attribute. Headers are added to each request, which
+// is useful for authentication.
+type OTLPExporter struct {
+	URL         string
+	ServiceName string
+	Headers     map[string]string
+	Client      *http.Client
+}
+
+// NewOTLPExporter creates an OTLPExporter with a client that times out after
+// ten seconds.
+func NewOTLPExporter(url, serviceName string) *OTLPExporter {
+	return &OTLPExporter{
+		URL:         url,
+		ServiceName: serviceName,
+		Headers:     map[string]string{},
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ExportSpans posts the spans to the collector. Any status other than 2xx is
+// an error.
+func (o *OTLPExporter) ExportSpans(spans []*Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(o.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", o.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("collector returned %s", res.Status)
+	}
+	return nil
+}
+
+// The types below are the parts of the OTLP JSON encoding that the exporter
+// uses. IDs are hex, and 64-bit integers are strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Flags             uint32          `json:"flags"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (o *OTLPExporter) request(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		out[i] = otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Flags:             uint32(s.Flags),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{s.Status, s.Message},
+		}
+		if s.Parent.IsValid() {
+			out[i].ParentSpanID = s.Parent.String()
+		}
+	}
+	resource := otlpAttributes([]Attribute{{"service.name", o.ServiceName}})
+	return otlpRequest{[]otlpResourceSpans{{
+		Resource:   otlpResource{resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{ScopeName}, Spans: out}},
+	}}}
+}
+
+func otlpAttributes(attrs []Attribute) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpValue
+		switch val := a.Value.(type) {
+		case string:
+			v.StringValue = &val
+		case bool:
+			v.BoolValue = &val
+		case int:
+			i := strconv.Itoa(val)
+			v.IntValue = &i
+		case int64:
+			i := strconv.FormatInt(val, 10)
+			v.IntValue = &i
+		case float64:
+			v.DoubleValue = &val
+		default:
+			str := fmt.Sprint(val)
+			v.StringValue = &str
+		}
+		out = append(out, otlpAttribute{a.Key, v})
+	}
+	return out
+}
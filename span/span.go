@@ -0,0 +1,199 @@
+// Package span records routes and commands as trace spans.
+//
+// A Tracer (a cookoo.Tracer) turns each request into a tree of spans: the
+// requested route is the root span, each command is a child of its route, and
+// each route reached by a Reroute or error handler is a child of the command
+// that led to it. When the request ends, its spans are queued, and sent to an
+// Exporter in the background.
+//
+// 	exporter := span.NewOTLPExporter("http://localhost:4318/v1/traces", "myapp")
+// 	tracer := span.NewTracer(exporter)
+// 	defer tracer.Close()
+// 	router.AddTracer(tracer)
+//
+// The spans follow OpenTelemetry's model, and the OTLPExporter sends them to
+// an OpenTelemetry collector using OTLP over HTTP, in JSON. For tests, the
+// MemoryExporter keeps them in memory.
+//
+// Trace context is carried between services with the W3C traceparent header.
+// The web.CookooHandler reads it from each request (see Propagate), so the
+// root span joins the caller's trace, and sends the root span's traceparent
+// back in the response.
+package span
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the ID in hex.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid checks that the ID is not all zeros.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the ID in hex.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid checks that the ID is not all zeros.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// FlagSampled is the trace flag that marks a trace as sampled.
+const FlagSampled byte = 1
+
+// SpanContext identifies a span, as carried by a traceparent header.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+}
+
+// IsValid checks that both IDs are set.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID.IsValid() && c.SpanID.IsValid()
+}
+
+// Traceparent formats the span context as a W3C traceparent header value:
+//
+// 	00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (c SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", c.TraceID, c.SpanID, c.Flags)
+}
+
+// ErrInvalidTraceparent is returned by ParseTraceparent for a bad header.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent reads a W3C traceparent header value.
+//
+// Versions other than 00 are read as far as version 00 goes, as the
+// specification asks.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var c SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return c, ErrInvalidTraceparent
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return c, ErrInvalidTraceparent
+	}
+	for _, p := range parts[:4] {
+		if strings.ToLower(p) != p {
+			return c, ErrInvalidTraceparent
+		}
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return c, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(c.TraceID[:], []byte(parts[1])); err != nil {
+		return c, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(c.SpanID[:], []byte(parts[2])); err != nil {
+		return c, ErrInvalidTraceparent
+	}
+	c.Flags = flags[0]
+	if !c.IsValid() {
+		return c, ErrInvalidTraceparent
+	}
+	return c, nil
+}
+
+// Kind says what sort of work a span stands for. The values are OTLP's.
+type Kind int
+
+const (
+	// KindInternal is work inside the program, like a command.
+	KindInternal Kind = 1
+	// KindServer is the handling of a request from a client.
+	KindServer Kind = 2
+)
+
+// StatusCode is the outcome of a span. The values are OTLP's.
+type StatusCode int
+
+const (
+	// StatusUnset means nothing went wrong.
+	StatusUnset StatusCode = 0
+	// StatusOK means the span was marked as a success.
+	StatusOK StatusCode = 1
+	// StatusError means the span failed.
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key/value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is one timed piece of work, like a route or a command.
+type Span struct {
+	Name string
+	Kind Kind
+	SpanContext
+	// Parent is the ID of the parent span. It is not valid for a root span
+	// that did not come with a traceparent.
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Status     StatusCode
+	// Message describes an error status.
+	Message string
+}
+
+// Attribute returns the value of an attribute, or nil.
+func (s *Span) Attribute(key string) interface{} {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// SetAttribute sets an attribute, replacing one with the same key.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	for i, a := range s.Attributes {
+		if a.Key == key {
+			s.Attributes[i].Value = value
+			return
+		}
+	}
+	s.Attributes = append(s.Attributes, Attribute{key, value})
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
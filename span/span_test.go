@@ -0,0 +1,344 @@
+package span
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatalf("! Unexpected error: %s", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || sc.Flags != FlagSampled {
+		t.Errorf("! Unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != tp {
+		t.Errorf("! Expected %s, got %s", tp, sc.Traceparent())
+	}
+
+	// A later version may add fields.
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); err != nil {
+		t.Errorf("! Expected a future version to parse, got %s", err)
+	}
+
+	bad := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01",
+	}
+	for _, b := range bad {
+		if _, err := ParseTraceparent(b); err != ErrInvalidTraceparent {
+			t.Errorf("! Expected %q to be invalid", b)
+		}
+	}
+}
+
+func nothing(cxt cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	return nil, nil
+}
+
+func fail(cxt cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	return nil, &cookoo.FatalError{"failed"}
+}
+
+func reroute(cxt cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	return nil, &cookoo.Reroute{"next"}
+}
+
+func TestTracer(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("first", "Reroutes").
+		Does(nothing, "a").
+		Does(reroute, "b").
+		Route("next", "Fails").
+		Does(fail, "c")
+
+	exp := &MemoryExporter{}
+	tracer := NewTracer(exp)
+	defer tracer.Close()
+	router.AddTracer(tracer)
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tp := Propagate(cxt, parent.Traceparent())
+
+	router.HandleRequest("first", cxt, false)
+	tracer.Flush()
+
+	spans := exp.Spans()
+	if len(spans) != 5 {
+		t.Fatalf("! Expected 5 spans, got %d", len(spans))
+	}
+	byName := map[string]*Span{}
+	for _, s := range spans {
+		byName[s.Name] = s
+		if s.TraceID != parent.TraceID {
+			t.Errorf("! Expected span %s in the caller's trace", s.Name)
+		}
+		if s.End.Before(s.Start) {
+			t.Errorf("! Span %s ends before it starts", s.Name)
+		}
+	}
+
+	root := byName["first"]
+	if root.Traceparent() != tp {
+		t.Errorf("! Expected the root span to match the propagated %s, got %s", tp, root.Traceparent())
+	}
+	if root.Kind != KindServer || root.Parent != parent.SpanID {
+		t.Errorf("! Expected a server span under the remote parent, got %+v", root)
+	}
+	if root.Status != StatusError {
+		t.Error("! Expected the root span to fail with the rerouted route.")
+	}
+
+	a, b, next, c := byName["a"], byName["b"], byName["next"], byName["c"]
+	if a.Parent != root.SpanID || b.Parent != root.SpanID {
+		t.Error("! Expected commands to be children of their route.")
+	}
+	if next.Parent != b.SpanID || c.Parent != next.SpanID {
+		t.Error("! Expected the rerouted route under the command that rerouted.")
+	}
+	if a.Attribute(RouteAttr) != "first" || a.Attribute(CommandAttr) != "a" || a.Attribute(InterruptAttr) != nil {
+		t.Errorf("! Unexpected attributes %v", a.Attributes)
+	}
+	if b.Attribute(InterruptAttr) != "Reroute" || b.Status != StatusUnset {
+		t.Errorf("! Expected a Reroute that is not an error, got %v", b.Attributes)
+	}
+	if c.Attribute(InterruptAttr) != "FatalError" || c.Status != StatusError || c.Message != "failed" {
+		t.Errorf("! Expected a failed span, got %+v", c)
+	}
+	if cur, ok := cxt.Get(CurrentKey, nil).(SpanContext); !ok || cur != c.SpanContext {
+		t.Error("! Expected the last command's span context in the context.")
+	}
+
+	// Without Propagate, a request starts its own trace.
+	exp.Reset()
+	_, router, cxt = cookoo.Cookoo()
+	router.SetRegistry(reg)
+	router.AddTracer(tracer)
+	router.HandleRequest("next", cxt, false)
+	tracer.Flush()
+	spans = exp.Spans()
+	if len(spans) != 2 || !spans[1].IsValid() || spans[1].Parent.IsValid() {
+		t.Errorf("! Expected a new trace, got %+v", spans)
+	}
+
+	// A later request on the same context is not part of the first one.
+	router.HandleRequest("next", cxt, false)
+	tracer.Flush()
+	spans = exp.Spans()
+	if len(spans) != 4 || spans[3].Parent.IsValid() || spans[3].TraceID == spans[1].TraceID {
+		t.Errorf("! Expected another new trace, got %+v", spans[3])
+	}
+}
+
+// failingExporter fails every export.
+type failingExporter struct{}
+
+func (failingExporter) ExportSpans(spans []*Span) error {
+	return errors.New("collector is down")
+}
+
+func TestTracerErrorLog(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("test", "Does nothing").Does(nothing, "a")
+
+	var buf bytes.Buffer
+	tracer := NewTracer(failingExporter{})
+	tracer.ErrorLog = log.New(&buf, "", 0)
+	defer tracer.Close()
+	router.AddTracer(tracer)
+
+	router.HandleRequest("test", cxt, false)
+	tracer.Flush()
+	if expect := "Could not export 2 spans: collector is down\n"; buf.String() != expect {
+		t.Errorf("! Expected %q, got %q", expect, buf.String())
+	}
+}
+
+func TestTracerPanic(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("first", "Reroutes").
+		Does(reroute, "a").
+		Route("next", "Panics").
+		Does(func(cxt cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+			panic("boom")
+		}, "b")
+
+	exp := &MemoryExporter{}
+	tracer := NewTracer(exp)
+	defer tracer.Close()
+	router.AddTracer(tracer)
+
+	func() {
+		defer func() { recover() }()
+		router.HandleRequest("first", cxt, false)
+	}()
+	tracer.Flush()
+
+	if len(tracer.spans) != 0 || len(tracer.requests) != 0 {
+		t.Errorf("! Expected the request to be forgotten, got %d spans and %d requests", len(tracer.spans), len(tracer.requests))
+	}
+	spans := exp.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("! Expected 4 spans, got %d", len(spans))
+	}
+	for _, s := range spans {
+		if s.Name != "a" && s.Status != StatusError {
+			t.Errorf("! Expected span %s to fail with the panic.", s.Name)
+		}
+	}
+}
+
+// blockingExporter waits for a signal before each export.
+type blockingExporter struct {
+	MemoryExporter
+	wait chan struct{}
+}
+
+func (b *blockingExporter) ExportSpans(spans []*Span) error {
+	<-b.wait
+	return b.MemoryExporter.ExportSpans(spans)
+}
+
+func TestTracerQueue(t *testing.T) {
+	reg, router, _ := cookoo.Cookoo()
+	reg.Route("test", "Does nothing").Does(nothing, "a")
+
+	exp := &blockingExporter{wait: make(chan struct{})}
+	tracer := newTracer(exp, 1)
+	router.AddTracer(tracer)
+
+	// Requests do not wait for the exporter. The first is taken off of the
+	// queue, the second waits in it, and the rest are dropped.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			_, _, cxt := cookoo.Cookoo()
+			router.HandleRequest("test", cxt, false)
+			if i == 0 {
+				// Let the export goroutine take the first request.
+				for len(tracer.queue) > 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("! Requests waited for the exporter.")
+	}
+	if d := tracer.Dropped(); d != 6 {
+		t.Errorf("! Expected 6 dropped spans, got %d", d)
+	}
+
+	close(exp.wait)
+	tracer.Close()
+	if n := len(exp.Spans()); n != 4 {
+		t.Errorf("! Expected 4 spans exported, got %d", n)
+	}
+
+	// After Close, spans are dropped, and Flush does not wait.
+	_, _, cxt := cookoo.Cookoo()
+	router.HandleRequest("test", cxt, false)
+	tracer.Flush()
+	tracer.Close()
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got map[string]interface{}
+	var contentType string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("! Could not decode body: %s", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s := &Span{
+		Name:        "GET /",
+		Kind:        KindServer,
+		SpanContext: sc,
+		Start:       time.Unix(1, 0),
+		End:         time.Unix(2, 5),
+		Status:      StatusError,
+		Message:     "oops",
+	}
+	s.SetAttribute(RouteAttr, "GET /")
+	s.SetAttribute("count", 3)
+
+	exp := NewOTLPExporter(collector.URL+"/v1/traces", "test")
+	if err := exp.ExportSpans([]*Span{s}); err != nil {
+		t.Fatalf("! Unexpected error: %s", err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("! Unexpected content type %q", contentType)
+	}
+
+	rs := got["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	attr := rs["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if attr["key"] != "service.name" || attr["value"].(map[string]interface{})["stringValue"] != "test" {
+		t.Errorf("! Unexpected resource attribute %v", attr)
+	}
+	ss := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})
+	if ss["scope"].(map[string]interface{})["name"] != ScopeName {
+		t.Errorf("! Unexpected scope %v", ss["scope"])
+	}
+	sp := ss["spans"].([]interface{})[0].(map[string]interface{})
+	expect := map[string]interface{}{
+		"traceId":           "4bf92f3577b34da6a3ce929d0e0e4736",
+		"spanId":            "00f067aa0ba902b7",
+		"name":              "GET /",
+		"kind":              float64(KindServer),
+		"startTimeUnixNano": "1000000000",
+		"endTimeUnixNano":   "2000000005",
+	}
+	for k, v := range expect {
+		if sp[k] != v {
+			t.Errorf("! Expected %s to be %v, got %v", k, v, sp[k])
+		}
+	}
+	if _, ok := sp["parentSpanId"]; ok {
+		t.Error("! Expected no parentSpanId for a root span.")
+	}
+	status := sp["status"].(map[string]interface{})
+	if status["code"] != float64(StatusError) || status["message"] != "oops" {
+		t.Errorf("! Unexpected status %v", status)
+	}
+	attrs := sp["attributes"].([]interface{})
+	count := attrs[1].(map[string]interface{})["value"].(map[string]interface{})
+	if count["intValue"] != "3" {
+		t.Errorf("! Expected an intValue, got %v", count)
+	}
+
+	// A failing collector is an error.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	exp.URL = failing.URL
+	if err := exp.ExportSpans([]*Span{s}); err == nil {
+		t.Error("! Expected an error from a failing collector.")
+	}
+}
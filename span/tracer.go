@@ -0,0 +1,367 @@
+package span
+
+import (
+	"log"
+	"sync"
+
+	"github.com/Masterminds/cookoo"
+)
+
+// Context keys used for trace propagation.
+const (
+	// ParentKey holds the SpanContext of a remote parent, read from an
+	// incoming traceparent header.
+	ParentKey = "trace.Parent"
+	// RootKey holds the SpanContext to use for the root span. Propagate sets
+	// it, so the root span's traceparent is known before the route runs.
+	RootKey = "trace.Root"
+	// CurrentKey holds the SpanContext of the command that is running. Use it
+	// (or Traceparent) to pass the trace on to other services.
+	CurrentKey = "trace.Current"
+	// RequestKey holds the SpanContext of the root span of a propagated
+	// request. A route run later for the same request, like @404 or @500,
+	// gets a span of its own under that one. Propagate clears it, and
+	// requests that were not propagated do not set it, so a long-lived
+	// context does not tie unrelated requests together.
+	RequestKey = "trace.Request"
+)
+
+// Attribute keys set on spans.
+const (
+	// RouteAttr holds the route's name, on route and command spans.
+	RouteAttr = "route.Name"
+	// CommandAttr holds the command's name, on command spans.
+	CommandAttr = "command.Name"
+	// InterruptAttr holds the type of Interrupt a command returned, like
+	// "FatalError" or "Reroute".
+	InterruptAttr = "command.Interrupt"
+)
+
+// Propagate prepares a context for tracing, given the value of an incoming
+// traceparent header (which may be empty).
+//
+// If the header is valid, the root span will be a child of the remote span.
+// Otherwise, the root span starts a new trace. Propagate returns the
+// traceparent for the root span, to send back to the client.
+func Propagate(cxt cookoo.Context, traceparent string) string {
+	root := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Flags: FlagSampled}
+	if parent, err := ParseTraceparent(traceparent); err == nil {
+		cxt.Put(ParentKey, parent)
+		root.TraceID = parent.TraceID
+		root.Flags = parent.Flags
+	}
+	cxt.Put(RootKey, root)
+	cxt.Put(RequestKey, nil)
+	return root.Traceparent()
+}
+
+// Traceparent returns the traceparent for the command that is running, or
+// an empty string if the request is not being traced.
+//
+// 	req.Header.Set("traceparent", span.Traceparent(cxt))
+func Traceparent(cxt cookoo.Context) string {
+	if sc, ok := cxt.Get(CurrentKey, nil).(SpanContext); ok {
+		return sc.Traceparent()
+	}
+	return ""
+}
+
+// Tracer is a cookoo.Tracer that records spans and sends them to an Exporter.
+//
+// Spans are collected as the request runs, and queued once the requested
+// route ends. A goroutine takes them off of the queue and exports them in
+// batches, so a slow exporter does not hold up requests. If the queue is
+// full, the request's spans are dropped and counted (see Dropped). An export
+// error is logged to ErrorLog.
+//
+// Call Close before the program exits, to export the spans still queued:
+//
+// 	tracer := span.NewTracer(exporter)
+// 	defer tracer.Close()
+// 	router.AddTracer(tracer)
+//
+// Each route span has the RouteAttr attribute. Each command span has
+// RouteAttr and CommandAttr, and InterruptAttr if the command returned an
+// Interrupt. Spans for routes that end in an error, and for commands that
+// return one (a FatalError, RecoverableError, Canceled, or any other error),
+// have an error status.
+type Tracer struct {
+	// ErrorLog logs export errors. If it is nil, Go's global logger is used.
+	// Set it before the Tracer is added to a router.
+	ErrorLog *log.Logger
+
+	exporter Exporter
+	queue    chan queued
+	stop     chan struct{}
+	closing  sync.Once
+
+	mutex   sync.Mutex
+	dropped uint64
+	// spans holds the span of each event, by event, until the request ends.
+	// A command's span must outlive the command, since a route it reroutes
+	// to starts after it ends.
+	spans    map[interface{}]*Span
+	requests map[*cookoo.RouteEvent]*request
+}
+
+// request holds the finished spans of a request, and the events of every span
+// that was started, finished or not.
+type request struct {
+	spans  []*Span
+	events []interface{}
+}
+
+// queued is an item on the export queue: the spans of a request, or a call
+// to Flush.
+type queued struct {
+	spans   []*Span
+	flushed chan struct{}
+}
+
+// QueueSize is the number of requests a Tracer queues for export. Requests
+// that end while the queue is full are dropped.
+const QueueSize = 1024
+
+// BatchSize is the most spans a Tracer sends to its exporter at once, unless
+// a single request has more.
+const BatchSize = 512
+
+// NewTracer creates a Tracer that exports to the given exporter, and starts
+// its export goroutine.
+func NewTracer(exporter Exporter) *Tracer {
+	return newTracer(exporter, QueueSize)
+}
+
+func newTracer(exporter Exporter, size int) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		queue:    make(chan queued, size),
+		stop:     make(chan struct{}),
+		spans:    map[interface{}]*Span{},
+		requests: map[*cookoo.RouteEvent]*request{},
+	}
+	go t.export()
+	return t
+}
+
+// RouteStart starts a span for a route.
+func (t *Tracer) RouteStart(cxt cookoo.Context, ev *cookoo.RouteEvent) {
+	s := &Span{Name: ev.Name, Kind: KindInternal, Start: ev.Start}
+	s.SetAttribute(RouteAttr, ev.Name)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if ev.Parent == nil {
+		if first, ok := cxt.Get(RequestKey, nil).(SpanContext); ok && first.IsValid() {
+			// The request already has a root span, so this is a route run
+			// after it, like a fallback.
+			s.SpanContext = SpanContext{TraceID: first.TraceID, SpanID: newSpanID(), Flags: first.Flags}
+			s.Parent = first.SpanID
+		} else {
+			s.Kind = KindServer
+			if root, ok := cxt.Get(RootKey, nil).(SpanContext); ok && root.IsValid() {
+				s.SpanContext = root
+				cxt.Put(RequestKey, root)
+			} else {
+				s.SpanContext = SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Flags: FlagSampled}
+			}
+			if parent, ok := cxt.Get(ParentKey, nil).(SpanContext); ok && parent.TraceID == s.TraceID {
+				s.Parent = parent.SpanID
+			}
+		}
+	} else if p, ok := t.spans[ev.Parent]; ok {
+		s.SpanContext = SpanContext{TraceID: p.TraceID, SpanID: newSpanID(), Flags: p.Flags}
+		s.Parent = p.SpanID
+	} else {
+		// The command that led here was not traced. Start a new trace.
+		s.SpanContext = SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Flags: FlagSampled}
+	}
+	t.start(ev, ev, s)
+}
+
+// CommandStart starts a span for a command, as a child of its route's span.
+func (t *Tracer) CommandStart(cxt cookoo.Context, ev *cookoo.CommandEvent) {
+	t.mutex.Lock()
+	p, ok := t.spans[ev.Route]
+	if !ok {
+		t.mutex.Unlock()
+		return
+	}
+	s := &Span{
+		Name:        ev.Name,
+		Kind:        KindInternal,
+		SpanContext: SpanContext{TraceID: p.TraceID, SpanID: newSpanID(), Flags: p.Flags},
+		Parent:      p.SpanID,
+		Start:       ev.Start,
+	}
+	s.SetAttribute(RouteAttr, ev.Route.Name)
+	s.SetAttribute(CommandAttr, ev.Name)
+	t.start(ev.Route, ev, s)
+	t.mutex.Unlock()
+
+	cxt.Put(CurrentKey, s.SpanContext)
+}
+
+// CommandEnd ends a command's span.
+func (t *Tracer) CommandEnd(cxt cookoo.Context, ev *cookoo.CommandEvent) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s, ok := t.spans[ev]
+	if !ok {
+		return
+	}
+	s.End = s.Start.Add(ev.Duration)
+	if ev.Interrupt != nil {
+		s.SetAttribute(InterruptAttr, cookoo.TypeName(ev.Interrupt))
+		if err, ok := ev.Interrupt.(error); ok {
+			s.Status = StatusError
+			s.Message = err.Error()
+		}
+	}
+	t.finish(ev.Route, s)
+}
+
+// RouteEnd ends a route's span. When the requested route ends, every span of
+// the request is queued for export.
+func (t *Tracer) RouteEnd(cxt cookoo.Context, ev *cookoo.RouteEvent) {
+	t.mutex.Lock()
+	s, ok := t.spans[ev]
+	if !ok {
+		t.mutex.Unlock()
+		return
+	}
+	s.End = s.Start.Add(ev.Duration)
+	if ev.Err != nil {
+		s.Status = StatusError
+		s.Message = ev.Err.Error()
+	}
+	t.finish(ev, s)
+
+	if ev.Parent != nil {
+		t.mutex.Unlock()
+		return
+	}
+	req := t.requests[ev]
+	delete(t.requests, ev)
+	for _, e := range req.events {
+		delete(t.spans, e)
+	}
+
+	select {
+	case t.queue <- queued{spans: req.spans}:
+	default:
+		t.dropped += uint64(len(req.spans))
+	}
+	t.mutex.Unlock()
+}
+
+// Dropped returns the number of spans dropped because the export queue was
+// full.
+func (t *Tracer) Dropped() uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.dropped
+}
+
+// Flush waits until every span queued so far has been exported.
+func (t *Tracer) Flush() {
+	done := make(chan struct{})
+	select {
+	case t.queue <- queued{flushed: done}:
+	case <-t.stop:
+		return
+	}
+	select {
+	case <-done:
+	case <-t.stop:
+	}
+}
+
+// Close exports the spans still queued, and stops the export goroutine.
+// Spans of requests that end after Close are not exported.
+func (t *Tracer) Close() error {
+	t.Flush()
+	t.closing.Do(func() { close(t.stop) })
+	return nil
+}
+
+// export takes spans off of the queue and exports them, in batches of up to
+// BatchSize spans, until the Tracer is closed.
+func (t *Tracer) export() {
+	for {
+		var batch []*Span
+		var flushed []chan struct{}
+		add := func(item queued) {
+			if item.flushed != nil {
+				flushed = append(flushed, item.flushed)
+				return
+			}
+			batch = append(batch, item.spans...)
+		}
+
+		// Wait for something to export, then take whatever else is queued.
+		select {
+		case item := <-t.queue:
+			add(item)
+		case <-t.stop:
+			return
+		}
+	more:
+		for len(batch) < BatchSize && len(flushed) == 0 {
+			select {
+			case item := <-t.queue:
+				add(item)
+			default:
+				break more
+			}
+		}
+
+		if len(batch) > 0 {
+			if err := t.exporter.ExportSpans(batch); err != nil {
+				t.logf("Could not export %d spans: %s", len(batch), err)
+			}
+		}
+		for _, done := range flushed {
+			close(done)
+		}
+	}
+}
+
+// logf logs a message to ErrorLog.
+func (t *Tracer) logf(format string, v ...interface{}) {
+	if t.ErrorLog != nil {
+		t.ErrorLog.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// start records a span for an event until its request ends. The caller must
+// hold the lock.
+func (t *Tracer) start(route *cookoo.RouteEvent, ev interface{}, s *Span) {
+	t.spans[ev] = s
+	req := t.request(route)
+	req.events = append(req.events, ev)
+}
+
+// finish adds a span to its request's finished spans. The caller must hold
+// the lock.
+func (t *Tracer) finish(route *cookoo.RouteEvent, s *Span) {
+	req := t.request(route)
+	req.spans = append(req.spans, s)
+}
+
+// request returns the request a route is part of. The caller must hold the
+// lock.
+func (t *Tracer) request(route *cookoo.RouteEvent) *request {
+	root := route
+	for root.Parent != nil {
+		root = root.Parent.Route
+	}
+	req, ok := t.requests[root]
+	if !ok {
+		req = &request{}
+		t.requests[root] = req
+	}
+	return req
+}
@@ -161,5 +161,14 @@ func (s *synchronizedContext) Logf(prefix, format string, v ...interface{}) {
 	s.cxt.Logf(prefix, format, v...)
 }
 
-
-
+// LogRaw writes a preformatted line to the underlying logger.
+//
+// If the underlying context is not a RawLogger, the line is logged with an
+// empty prefix. Like Log, this is not synchronized.
+func (s *synchronizedContext) LogRaw(line []byte) {
+	if raw, ok := s.cxt.(RawLogger); ok {
+		raw.LogRaw(line)
+		return
+	}
+	s.cxt.Log("", string(line))
+}
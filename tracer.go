@@ -0,0 +1,264 @@
+package cookoo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer receives events as the Router executes routes and commands.
+//
+// A Tracer is attached to a Router with Router.SetTracer or Router.AddTracer.
+// The router then calls the Tracer as follows:
+//
+// 	- RouteStart: before the first command on a route is run.
+// 	- CommandStart: after a command's Params have been resolved, but before
+// 	  the command (and any middleware) is called.
+// 	- CommandEnd: after the command returns.
+// 	- RouteEnd: after the last command on the route, or after the route is
+// 	  stopped by an interrupt.
+//
+// If a command panics, CommandEnd and RouteEnd are still sent for everything
+// that started, with a FatalError as the interrupt and error, before the
+// panic goes on.
+//
+// When a command returns a Reroute, or when an error handler is run (see
+// Registry.OnError), the new route's events are nested inside of the
+// command that caused it: RouteStart and RouteEnd for the new route arrive
+// after the command's CommandEnd, but before the RouteEnd of the route the
+// command was on. The event's Parent field points to that command.
+//
+// The events are shared by all tracers on a router, and are filled in as
+// execution goes on. Tracers should not modify them.
+//
+// A Router is shared by every request, so a Tracer may be called from many
+// goroutines at once.
+type Tracer interface {
+	RouteStart(cxt Context, route *RouteEvent)
+	CommandStart(cxt Context, cmd *CommandEvent)
+	CommandEnd(cxt Context, cmd *CommandEvent)
+	RouteEnd(cxt Context, route *RouteEvent)
+}
+
+// RequestErrorTracer is a Tracer that is also told about requests that fail
+// before any route starts, such as a request for a route that does not exist
+// (a RouteError) or, on the web, for a path that exists with another method.
+//
+// No RouteStart or RouteEnd is sent for such a request, since no route ran.
+// The name is the request's name, as given to Router.HandleRequest, or the
+// route it resolved to.
+type RequestErrorTracer interface {
+	Tracer
+	RequestError(cxt Context, name string, err error)
+}
+
+// RouteEvent describes one run of a route.
+//
+// Duration and Err are set when the route ends.
+type RouteEvent struct {
+	Name string
+	// Parent is the command that caused this route to run, or nil if this is
+	// the route that was requested.
+	Parent *CommandEvent
+	// Commands are the commands that have run on this route, in order.
+	Commands []*CommandEvent
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// Depth returns the number of routes above this one.
+//
+// The requested route has a depth of 0.
+func (e *RouteEvent) Depth() int {
+	depth := 0
+	for p := e.Parent; p != nil; p = p.Route.Parent {
+		depth++
+	}
+	return depth
+}
+
+// CommandEvent describes one run of a command.
+//
+// Params are the resolved params the command was called with. Duration,
+// Result, and Interrupt are set when the command ends.
+type CommandEvent struct {
+	Name  string
+	Route *RouteEvent
+	// Routes are the routes run because of this command (by a Reroute or an
+	// error handler).
+	Routes    []*RouteEvent
+	Params    *Params
+	Start     time.Time
+	Duration  time.Duration
+	Result    interface{}
+	Interrupt Interrupt
+}
+
+// traceRouteStart sends a RouteStart event to every tracer.
+func (r *Router) traceRouteStart(cxt Context, ev *RouteEvent) {
+	for _, t := range r.tracers {
+		t.RouteStart(cxt, ev)
+	}
+}
+
+// traceRouteEnd sends a RouteEnd event to every tracer.
+func (r *Router) traceRouteEnd(cxt Context, ev *RouteEvent) {
+	for _, t := range r.tracers {
+		t.RouteEnd(cxt, ev)
+	}
+}
+
+// traceRequestError sends a RequestError event to every tracer that takes
+// them.
+func (r *Router) traceRequestError(cxt Context, name string, err error) {
+	for _, t := range r.tracers {
+		if et, ok := t.(RequestErrorTracer); ok {
+			et.RequestError(cxt, name, err)
+		}
+	}
+}
+
+// traceCommandStart sends a CommandStart event to every tracer.
+func (r *Router) traceCommandStart(cxt Context, ev *CommandEvent) {
+	for _, t := range r.tracers {
+		t.CommandStart(cxt, ev)
+	}
+}
+
+// traceCommandEnd sends a CommandEnd event to every tracer.
+func (r *Router) traceCommandEnd(cxt Context, ev *CommandEvent) {
+	for _, t := range r.tracers {
+		t.CommandEnd(cxt, ev)
+	}
+}
+
+// endCommandOnPanic ends a command's trace if the command panics, and then
+// lets the panic go on. It must be deferred.
+func (r *Router) endCommandOnPanic(cxt Context, ev *CommandEvent) {
+	if e := recover(); e != nil {
+		ev.Duration = time.Since(ev.Start)
+		ev.Interrupt = &FatalError{fmt.Sprintf("Command %s panicked: %v", ev.Name, e)}
+		r.traceCommandEnd(cxt, ev)
+		panic(e)
+	}
+}
+
+// endRouteOnPanic ends a route's trace if one of its commands panics, and
+// then lets the panic go on. It must be deferred.
+func (r *Router) endRouteOnPanic(cxt Context, ev *RouteEvent) {
+	if e := recover(); e != nil {
+		ev.Duration = time.Since(ev.Start)
+		ev.Err = &FatalError{fmt.Sprintf("Route %s panicked: %v", ev.Name, e)}
+		r.traceRouteEnd(cxt, ev)
+		panic(e)
+	}
+}
+
+// TraceKey is the context key under which a ContextTracer stores a trace.
+const TraceKey = "route.Trace"
+
+// ContextTracer records a trace of each request into its context.
+//
+// When the requested route starts, its *RouteEvent is placed into the context
+// under the key `route.Trace`. As execution goes on, the event fills in with
+// every command run (with its params, result, interrupt, and timing), along
+// with any routes reached by Reroute or error handlers.
+//
+// 	router.SetTracer(cookoo.ContextTracer{})
+// 	router.HandleRequest("test", cxt, false)
+// 	trace := cxt.Get(cookoo.TraceKey, nil).(*cookoo.RouteEvent)
+type ContextTracer struct{}
+
+// RouteStart stores the requested route's event in the context.
+func (t ContextTracer) RouteStart(cxt Context, ev *RouteEvent) {
+	if ev.Parent == nil {
+		cxt.Put(TraceKey, ev)
+	}
+}
+
+// RouteEnd does nothing. The event stored by RouteStart is already complete.
+func (t ContextTracer) RouteEnd(cxt Context, ev *RouteEvent) {}
+
+// CommandStart does nothing.
+func (t ContextTracer) CommandStart(cxt Context, ev *CommandEvent) {}
+
+// CommandEnd does nothing.
+func (t ContextTracer) CommandEnd(cxt Context, ev *CommandEvent) {}
+
+// WriterTracer prints a tree of every request to an io.Writer.
+//
+// Each tree is written in one piece once the requested route ends, so trees
+// from concurrent requests are not mixed together. Output looks like this:
+//
+// 	TEST (1.208ms)
+// 	  - first (12.1µs) params: a=1
+// 	  - forward (3.2µs) => *cookoo.Reroute
+// 	    TEST2 (1.1ms)
+// 	      - fake2 (8.7µs)
+type WriterTracer struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// NewWriterTracer creates a new WriterTracer that writes to the given writer.
+func NewWriterTracer(writer io.Writer) *WriterTracer {
+	return &WriterTracer{writer: writer}
+}
+
+// RouteStart does nothing.
+func (t *WriterTracer) RouteStart(cxt Context, ev *RouteEvent) {}
+
+// CommandStart does nothing.
+func (t *WriterTracer) CommandStart(cxt Context, ev *CommandEvent) {}
+
+// CommandEnd does nothing.
+func (t *WriterTracer) CommandEnd(cxt Context, ev *CommandEvent) {}
+
+// RouteEnd writes the tree when the requested route ends.
+func (t *WriterTracer) RouteEnd(cxt Context, ev *RouteEvent) {
+	if ev.Parent != nil {
+		return
+	}
+	var b strings.Builder
+	writeRouteTrace(&b, ev, "")
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	io.WriteString(t.writer, b.String())
+}
+
+// writeRouteTrace writes a route and everything under it.
+func writeRouteTrace(b *strings.Builder, ev *RouteEvent, indent string) {
+	fmt.Fprintf(b, "%s%s (%s)", indent, ev.Name, ev.Duration)
+	if ev.Err != nil {
+		fmt.Fprintf(b, " error: %s", ev.Err)
+	}
+	b.WriteString("\n")
+
+	for _, cmd := range ev.Commands {
+		fmt.Fprintf(b, "%s  - %s (%s)", indent, cmd.Name, cmd.Duration)
+		if cmd.Params != nil && cmd.Params.Len() > 0 {
+			b.WriteString(" params:")
+			params := cmd.Params.AsMap()
+			names := make([]string, 0, len(params))
+			for name := range params {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(b, " %s=%v", name, params[name])
+			}
+		}
+		if cmd.Interrupt != nil {
+			fmt.Fprintf(b, " => %T", cmd.Interrupt)
+		}
+		b.WriteString("\n")
+		for _, sub := range cmd.Routes {
+			writeRouteTrace(b, sub, indent+"    ")
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package cookoo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// eventLog is a Tracer that records the events it sees.
+type eventLog struct {
+	events []string
+}
+
+func (l *eventLog) RouteStart(cxt Context, ev *RouteEvent) {
+	l.events = append(l.events, "route:"+ev.Name)
+}
+func (l *eventLog) CommandStart(cxt Context, ev *CommandEvent) {
+	l.events = append(l.events, "start:"+ev.Name)
+}
+func (l *eventLog) CommandEnd(cxt Context, ev *CommandEvent) {
+	l.events = append(l.events, "end:"+ev.Name)
+}
+func (l *eventLog) RouteEnd(cxt Context, ev *RouteEvent) {
+	l.events = append(l.events, "/route:"+ev.Name)
+}
+
+func TestTracerEvents(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.
+		Route("TEST", "A test route").
+		Does(FetchParams, "first").Using("a").WithDefault(1).
+		Does(RerouteCommand, "forward").Using("route").WithDefault("TEST2").
+		Route("TEST2", "Rerouted").
+		Does(FatalErrorCommand, "fail")
+
+	events := &eventLog{}
+	router.SetTracer(events)
+	router.AddTracer(ContextTracer{})
+
+	if err := router.HandleRequest("TEST", cxt, false); err == nil {
+		t.Error("! Expected an error from TEST2.")
+	}
+
+	expect := "route:TEST start:first end:first start:forward end:forward route:TEST2 start:fail end:fail /route:TEST2 /route:TEST"
+	if got := strings.Join(events.events, " "); got != expect {
+		t.Errorf("! Expected events %q, got %q", expect, got)
+	}
+
+	trace, ok := cxt.Get(TraceKey, nil).(*RouteEvent)
+	if !ok {
+		t.Fatal("! Expected a trace in the context.")
+	}
+	if trace.Name != "TEST" || trace.Err == nil {
+		t.Errorf("! Unexpected trace root %s: %v", trace.Name, trace.Err)
+	}
+	if len(trace.Commands) != 2 {
+		t.Fatalf("! Expected 2 commands, got %d", len(trace.Commands))
+	}
+	first := trace.Commands[0]
+	if first.Params.Get("a", 0) != 1 {
+		t.Error("! Expected resolved params in the trace.")
+	}
+	if _, ok := first.Result.(*Params); !ok {
+		t.Errorf("! Expected the command result in the trace, got %T", first.Result)
+	}
+	forward := trace.Commands[1]
+	if _, ok := forward.Interrupt.(*Reroute); !ok {
+		t.Errorf("! Expected a Reroute interrupt, got %T", forward.Interrupt)
+	}
+	if len(forward.Routes) != 1 {
+		t.Fatalf("! Expected one nested route, got %d", len(forward.Routes))
+	}
+	nested := forward.Routes[0]
+	if nested.Name != "TEST2" || nested.Parent != forward || nested.Depth() != 1 {
+		t.Errorf("! Unexpected nested route %s at depth %d", nested.Name, nested.Depth())
+	}
+	if _, ok := nested.Commands[0].Interrupt.(*FatalError); !ok {
+		t.Error("! Expected a FatalError on the nested command.")
+	}
+
+	router.SetTracer(nil)
+	if len(router.Tracers()) != 0 {
+		t.Error("! Expected tracing to be turned off.")
+	}
+}
+
+func TestTracerPanic(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.Route("TEST", "Panics").
+		Does(func(cxt Context, p *Params) (interface{}, Interrupt) {
+			panic("boom")
+		}, "boom")
+
+	events := &eventLog{}
+	router.SetTracer(events)
+	router.AddTracer(ContextTracer{})
+
+	func() {
+		defer func() {
+			if e := recover(); e != "boom" {
+				t.Errorf("! Expected the panic to go on, got %v", e)
+			}
+		}()
+		router.HandleRequest("TEST", cxt, false)
+	}()
+
+	expect := "route:TEST start:boom end:boom /route:TEST"
+	if got := strings.Join(events.events, " "); got != expect {
+		t.Errorf("! Expected events %q, got %q", expect, got)
+	}
+	trace := cxt.Get(TraceKey, nil).(*RouteEvent)
+	if _, ok := trace.Commands[0].Interrupt.(*FatalError); !ok {
+		t.Errorf("! Expected a FatalError for the panic, got %T", trace.Commands[0].Interrupt)
+	}
+	if _, ok := trace.Err.(*FatalError); !ok {
+		t.Errorf("! Expected the route to fail, got %v", trace.Err)
+	}
+}
+
+func TestWriterTracer(t *testing.T) {
+	reg, router, cxt := Cookoo()
+	reg.
+		Route("TEST", "A test route").
+		Does(FetchParams, "first").Using("a").WithDefault(1).Using("b").WithDefault("x").
+		Does(RerouteCommand, "forward").Using("route").WithDefault("TEST2").
+		Route("TEST2", "Rerouted").
+		Does(MockCommand, "last")
+
+	var out bytes.Buffer
+	router.SetTracer(NewWriterTracer(&out))
+	if err := router.HandleRequest("TEST", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("! Expected 5 lines, got %q", out.String())
+	}
+	checks := []string{"TEST (", "  - first (", "  - forward (", "    TEST2 (", "      - last ("}
+	for i, prefix := range checks {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("! Expected line %d to start with %q, got %q", i, prefix, lines[i])
+		}
+	}
+	if !strings.HasSuffix(lines[1], "params: a=1 b=x") {
+		t.Errorf("! Expected params on line 1, got %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "=> *cookoo.Reroute") {
+		t.Errorf("! Expected reroute on line 2, got %q", lines[2])
+	}
+}
@@ -0,0 +1,153 @@
+package cookoo
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RegistryKey is the context key for the Registry that URLFunc builds URLs
+// with.
+//
+// The web.CookooHandler puts its Registry here for each request. Elsewhere,
+// put it into the context yourself:
+//
+// 	cxt.Put(cookoo.RegistryKey, reg)
+const RegistryKey = "cookoo.Registry"
+
+// Alias gives the current route another name, for use with URL.
+//
+// Aliases keep templates and redirects from depending on a route's full name,
+// which may change:
+//
+// 	reg.Route("GET /users/{id}", "Show a user").Alias("user.show")
+// 	reg.URL("user.show", "id", 5) // "/users/5"
+//
+// Aliases are not route names; the Router does not resolve them.
+//
+// Alias panics if it is called before Route, or if another route already
+// has the alias.
+func (r *Registry) Alias(alias string) *Registry {
+	if r.currentRoute == nil {
+		panic(fmt.Sprintf("Alias %s has no route. Call Route first.", alias))
+	}
+	if err := r.setAlias(alias, r.currentRoute.name); err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+func (r *Registry) setAlias(alias, route string) error {
+	if r.aliases == nil {
+		r.aliases = map[string]string{}
+	}
+	if old, ok := r.aliases[alias]; ok && old != route {
+		return fmt.Errorf("Alias %s is already used by route %s", alias, old)
+	}
+	r.aliases[alias] = route
+	return nil
+}
+
+// RouteForAlias returns the name of the route with the given alias.
+func (r *Registry) RouteForAlias(alias string) (string, bool) {
+	name, ok := r.aliases[alias]
+	return name, ok
+}
+
+// URL builds the path of a route, given its name or alias and parameter
+// values as name/value pairs.
+//
+// Path parameters in the route name (like {id} in "GET /users/{id}") are
+// replaced by the values of the same names, which are escaped. The other
+// pairs are added as a query string, sorted by name. Any verb at the front of
+// the route name is dropped:
+//
+// 	reg.Route("GET /users/{id}/posts", "List posts").Alias("user.posts")
+// 	reg.URL("user.posts", "id", 5, "page", 2) // "/users/5/posts?page=2"
+//
+// A value that does not match a parameter's expression is an error, as is a
+// missing parameter. So is a route that is not a path, or that has wildcards,
+// since there is no single path to build.
+func (r *Registry) URL(name string, params ...interface{}) (string, error) {
+	route := name
+	if _, ok := r.routes[route]; !ok {
+		if route, ok = r.aliases[name]; !ok {
+			return "", fmt.Errorf("No route or alias named %s", name)
+		}
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("URL for %s: parameters must be name/value pairs", name)
+	}
+
+	values := make(map[string][]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("URL for %s: parameter name %v is not a string", name, params[i])
+		}
+		values[key] = append(values[key], fmt.Sprint(params[i+1]))
+	}
+
+	_, p := splitRouteVerb(route)
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("URL for %s: route %s is not a path", name, route)
+	}
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			param := seg[1 : len(seg)-1]
+			var expr string
+			if c := strings.Index(param, ":"); c >= 0 {
+				param, expr = param[:c], param[c+1:]
+			}
+			vals := values[param]
+			if len(vals) == 0 || len(vals[0]) == 0 {
+				return "", fmt.Errorf("URL for %s: missing parameter %s", name, param)
+			}
+			if len(expr) > 0 {
+				re, err := regexp.Compile("^(?:" + expr + ")$")
+				if err != nil {
+					return "", fmt.Errorf("URL for %s: %s", name, err)
+				}
+				if !re.MatchString(vals[0]) {
+					return "", fmt.Errorf("URL for %s: %s does not match %s", name, vals[0], seg)
+				}
+			}
+			segs[i] = url.PathEscape(vals[0])
+			if len(vals) == 1 {
+				delete(values, param)
+			} else {
+				values[param] = vals[1:]
+			}
+			continue
+		}
+		if strings.ContainsAny(seg, `*?[\`) {
+			return "", fmt.Errorf("URL for %s: route %s has wildcards", name, route)
+		}
+	}
+
+	out := strings.Join(segs, "/")
+	if len(values) > 0 {
+		out += "?" + url.Values(values).Encode()
+	}
+	return out, nil
+}
+
+// URLFunc returns a function that builds URLs with the Registry in the
+// context (see RegistryKey). It is meant for templates:
+//
+// 	tpl := template.New("page").Funcs(template.FuncMap{"url": cookoo.URLFunc(cxt)})
+//
+// 	<a href="{{url "user.show" "id" .User.ID}}">Profile</a>
+//
+// If the context has no Registry, the function returns an error.
+func URLFunc(cxt Context) func(name string, params ...interface{}) (string, error) {
+	return func(name string, params ...interface{}) (string, error) {
+		reg, ok := cxt.Get(RegistryKey, nil).(*Registry)
+		if !ok || reg == nil {
+			return "", fmt.Errorf("No registry to build the URL for %s", name)
+		}
+		return reg.URL(name, params...)
+	}
+}
@@ -0,0 +1,100 @@
+package cookoo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	reg := NewRegistry()
+	reg.Route("GET /users/{id:[0-9]+}", "Show a user").Alias("user.show")
+	reg.Route("GET /users/{id}/posts/{slug}", "Show a post").Alias("post.show")
+	reg.Route("GET /files/**", "Files").Alias("files")
+	reg.Route("@boot", "Not a path").Alias("boot")
+	reg.AddRoute(Route{Name: "POST /users", Alias: "user.create"})
+	reg.Group("/api").Route("GET /status", "Status").Alias("api.status")
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		expect string
+	}{
+		{"user.show", []interface{}{"id", 5}, "/users/5"},
+		{"GET /users/{id:[0-9]+}", []interface{}{"id", 5}, "/users/5"},
+		{"post.show", []interface{}{"slug", "a b/c", "id", 1}, "/users/1/posts/a%20b%2Fc"},
+		{"user.create", []interface{}{"q", "x&y", "a", 1, "a", 2}, "/users?a=1&a=2&q=x%26y"},
+		{"api.status", nil, "/api/status"},
+	}
+	for _, tt := range tests {
+		got, err := reg.URL(tt.name, tt.params...)
+		if err != nil {
+			t.Errorf("! Unexpected error for %s: %s", tt.name, err)
+		} else if got != tt.expect {
+			t.Errorf("! Expected %s, got %s", tt.expect, got)
+		}
+	}
+
+	bad := []struct {
+		name   string
+		params []interface{}
+		expect string
+	}{
+		{"nope", nil, "No route or alias"},
+		{"user.show", nil, "missing parameter id"},
+		{"user.show", []interface{}{"id", "bob"}, "does not match"},
+		{"user.show", []interface{}{"id"}, "pairs"},
+		{"user.show", []interface{}{5, 5}, "not a string"},
+		{"files", nil, "wildcards"},
+		{"boot", nil, "not a path"},
+	}
+	for _, tt := range bad {
+		if _, err := reg.URL(tt.name, tt.params...); err == nil || !strings.Contains(err.Error(), tt.expect) {
+			t.Errorf("! Expected an error with %q for %s %v, got %v", tt.expect, tt.name, tt.params, err)
+		}
+	}
+
+	if route, ok := reg.RouteForAlias("api.status"); !ok || route != "GET /api/status" {
+		t.Errorf("! Unexpected route for alias: %s", route)
+	}
+}
+
+func TestAliasFails(t *testing.T) {
+	reg := NewRegistry()
+	mustPanic := func(msg string, fn func()) {
+		defer func() {
+			if recover() == nil {
+				t.Error(msg)
+			}
+		}()
+		fn()
+	}
+
+	mustPanic("! Expected a panic for an alias with no route.", func() { reg.Alias("home") })
+
+	reg.Route("GET /", "Index").Alias("home")
+	mustPanic("! Expected a panic for a duplicate alias.", func() { reg.Route("GET /other", "Other").Alias("home") })
+	if route, _ := reg.RouteForAlias("home"); route != "GET /" {
+		t.Errorf("! Expected the first alias to be kept, got %s", route)
+	}
+
+	if err := reg.AddRoute(Route{Name: "GET /more", Alias: "home"}); err == nil {
+		t.Error("! Expected an error for a duplicate alias.")
+	}
+	if _, ok := reg.RouteSpec("GET /more"); ok {
+		t.Error("! Expected the route not to be added.")
+	}
+}
+
+func TestURLFunc(t *testing.T) {
+	reg, _, cxt := Cookoo()
+	reg.Route("GET /", "Index").Alias("home")
+
+	url := URLFunc(cxt)
+	if _, err := url("home"); err == nil {
+		t.Error("! Expected an error without a registry in the context.")
+	}
+	cxt.Put(RegistryKey, reg)
+	if u, err := url("home", "page", 2); err != nil || u != "/?page=2" {
+		t.Errorf("! Unexpected URL %s, %v", u, err)
+	}
+}
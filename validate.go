@@ -0,0 +1,485 @@
+package cookoo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Severity indicates how serious a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityError marks a problem that will cause a route to fail.
+	SeverityError Severity = iota
+	// SeverityWarning marks something that is probably, but not certainly, a
+	// mistake.
+	SeverityWarning
+)
+
+// String returns "error" or "warning".
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic describes a problem found by Registry.Validate.
+//
+// Route is always set. Command and Param are set when the problem is specific
+// to a command or a param.
+type Diagnostic struct {
+	Severity Severity
+	Route    string
+	Command  string
+	Param    string
+	Message  string
+}
+
+// Error formats the diagnostic as a single line.
+func (d *Diagnostic) Error() string {
+	where := []string{fmt.Sprintf("route '%s'", d.Route)}
+	if len(d.Command) > 0 {
+		where = append(where, fmt.Sprintf("command '%s'", d.Command))
+	}
+	if len(d.Param) > 0 {
+		where = append(where, fmt.Sprintf("param '%s'", d.Param))
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Severity, strings.Join(where, ", "), d.Message)
+}
+
+// Diagnostics is a list of problems found by Registry.Validate.
+type Diagnostics []*Diagnostic
+
+// Errors returns only the diagnostics with SeverityError.
+func (d Diagnostics) Errors() Diagnostics {
+	return d.filter(SeverityError)
+}
+
+// Warnings returns only the diagnostics with SeverityWarning.
+func (d Diagnostics) Warnings() Diagnostics {
+	return d.filter(SeverityWarning)
+}
+
+func (d Diagnostics) filter(s Severity) Diagnostics {
+	out := Diagnostics{}
+	for _, diag := range d {
+		if diag.Severity == s {
+			out = append(out, diag)
+		}
+	}
+	return out
+}
+
+// String returns one diagnostic per line.
+func (d Diagnostics) String() string {
+	lines := make([]string, len(d))
+	for i, diag := range d {
+		lines[i] = diag.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// frameworkKeys are context keys set by the Router itself.
+var frameworkKeys = []string{
+	"route.Name",
+	"route.Description",
+	"route.RequestName",
+	"route.History",
+	"command.Name",
+	"error",
+	"error.Route",
+	"error.Command",
+	LoopIndexKey,
+	LoopValueKey,
+	StdContextKey,
+	RequestIDKey,
+	RegistryKey,
+}
+
+// Validate checks every route in the registry for mistakes that would
+// otherwise only show up when the route is run.
+//
+// The following are reported as errors:
+//
+// 	- Two routes declared with the same name (the later one wins).
+// 	- References to routes that do not exist. This covers Includes, the
+// 	  targets of OnError and Catch, and the route given to ForwardTo.
+// 	- Cycles among those references (e.g. two routes that are each other's
+// 	  error handler).
+// 	- An alias for a route that does not exist, or an alias that is also a
+// 	  route name, which URL would take to be the route.
+// 	- A CmdDef with a Using param that does not match any of its fields.
+// 	- A typed param whose type is not one of the ParamTypes, or whose default
+// 	  cannot be converted to its type.
+//
+// The following are reported as warnings, since they depend on what is in
+// the context at runtime:
+//
+// 	- A From source like "cxt:foo" where no earlier command on the route
+// 	  produces "foo". (A command produces the context key with its name, and
+// 	  AddToContext produces each of its params. Commands in a Parallel group
+// 	  only see what was produced before the group.)
+// 	- A CmdDef field that takes its value from params, but has no matching
+// 	  Using param.
+//
+// Validate is intended to be run from a unit test:
+//
+// 	func TestRoutes(t *testing.T) {
+// 		reg := cookoo.NewRegistry()
+// 		buildRoutes(reg)
+// 		if diags := reg.Validate().Errors(); len(diags) > 0 {
+// 			t.Fatal(diags)
+// 		}
+// 	}
+func (r *Registry) Validate() Diagnostics {
+	diags := Diagnostics{}
+
+	seen := make(map[string]bool, len(r.orderedRouteNames))
+	names := make([]string, 0, len(r.orderedRouteNames))
+	for _, name := range r.orderedRouteNames {
+		if seen[name] {
+			diags = append(diags, &Diagnostic{
+				Severity: SeverityError,
+				Route:    name,
+				Message:  "route is declared more than once",
+			})
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		spec := r.routes[name]
+		diags = append(diags, r.validateReferences(spec)...)
+		diags = append(diags, validateFrom(spec)...)
+		for _, cmd := range allCommands(spec.commands) {
+			diags = append(diags, validateCmdDef(spec, cmd)...)
+			diags = append(diags, validateTypes(spec, cmd)...)
+		}
+	}
+	diags = append(diags, r.validateAliases()...)
+
+	return append(diags, r.validateCycles(names)...)
+}
+
+// validateAliases checks that every alias names a route, and is not itself
+// the name of a route.
+func (r *Registry) validateAliases() Diagnostics {
+	aliases := make([]string, 0, len(r.aliases))
+	for alias := range r.aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	diags := Diagnostics{}
+	for _, alias := range aliases {
+		target := r.aliases[alias]
+		if _, ok := r.routes[target]; !ok {
+			diags = append(diags, &Diagnostic{
+				Severity: SeverityError,
+				Route:    target,
+				Message:  fmt.Sprintf("alias '%s' is for a route that does not exist", alias),
+			})
+		} else if _, ok := r.routes[alias]; ok {
+			diags = append(diags, &Diagnostic{
+				Severity: SeverityError,
+				Route:    target,
+				Message:  fmt.Sprintf("alias '%s' is also a route name, so URL will use that route", alias),
+			})
+		}
+	}
+	return diags
+}
+
+// routeRef is a reference from a route to another route.
+type routeRef struct {
+	kind, command, target string
+}
+
+// references lists every route a route may send execution to.
+func (r *Registry) references(spec *routeSpec) []routeRef {
+	refs := []routeRef{}
+	for _, inc := range spec.includes {
+		refs = append(refs, routeRef{"include", "", inc})
+	}
+	if len(spec.onError) > 0 {
+		refs = append(refs, routeRef{"error handler", "", spec.onError})
+	}
+	forwardTo := reflect.ValueOf(ForwardTo).Pointer()
+	for _, cmd := range allCommands(spec.commands) {
+		if len(cmd.catch) > 0 {
+			refs = append(refs, routeRef{"catch route", cmd.name, cmd.catch})
+		}
+		if cmd.command != nil && reflect.ValueOf(cmd.command).Pointer() == forwardTo {
+			for _, p := range cmd.parameters {
+				if target, ok := p.defaultValue.(string); ok && p.name == "route" && len(p.from) == 0 {
+					refs = append(refs, routeRef{"reroute target", cmd.name, target})
+				}
+			}
+		}
+	}
+	return refs
+}
+
+func (r *Registry) validateReferences(spec *routeSpec) Diagnostics {
+	diags := Diagnostics{}
+	for _, ref := range r.references(spec) {
+		if _, ok := r.routes[ref.target]; !ok {
+			diags = append(diags, &Diagnostic{
+				Severity: SeverityError,
+				Route:    spec.name,
+				Command:  ref.command,
+				Message:  fmt.Sprintf("%s '%s' does not exist", ref.kind, ref.target),
+			})
+		}
+	}
+	return diags
+}
+
+// validateCycles finds loops among route references.
+func (r *Registry) validateCycles(names []string) Diagnostics {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	diags := Diagnostics{}
+	state := make(map[string]int, len(names))
+	path := []string{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		path = append(path, name)
+
+		targets := []string{}
+		for _, ref := range r.references(r.routes[name]) {
+			// Included commands are copied in. Execution never moves to
+			// the included route.
+			if ref.kind != "include" {
+				targets = append(targets, ref.target)
+			}
+		}
+		sort.Strings(targets)
+		for _, target := range targets {
+			if _, ok := r.routes[target]; !ok {
+				continue
+			}
+			switch state[target] {
+			case unvisited:
+				visit(target)
+			case visiting:
+				start := 0
+				for i, n := range path {
+					if n == target {
+						start = i
+					}
+				}
+				cycle := append(append([]string{}, path[start:]...), target)
+				diags = append(diags, &Diagnostic{
+					Severity: SeverityError,
+					Route:    target,
+					Message:  "route cycle: " + strings.Join(cycle, " -> "),
+				})
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = done
+	}
+
+	for _, name := range names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return diags
+}
+
+// validateFrom checks that context sources refer to keys that something
+// earlier on the route produces.
+func validateFrom(spec *routeSpec) Diagnostics {
+	produced := make(map[string]bool, len(frameworkKeys)+len(spec.commands))
+	for _, k := range frameworkKeys {
+		produced[k] = true
+	}
+	return checkFrom(spec, spec.commands, produced, true)
+}
+
+// checkFrom checks the context sources of commands against the keys produced
+// before them.
+//
+// Commands in a Parallel group cannot see each other's results, so they are
+// not run in sequence: each is checked against what was produced before the
+// group.
+func checkFrom(spec *routeSpec, cmds []*commandSpec, produced map[string]bool, sequence bool) Diagnostics {
+	diags := Diagnostics{}
+	for _, cmd := range cmds {
+		switch {
+		case cmd.block == nil:
+			diags = append(diags, checkParamsFrom(spec, cmd, produced)...)
+		case cmd.block.kind == parallelBlock:
+			diags = append(diags, checkFrom(spec, cmd.block.commands, produced, false)...)
+		default:
+			diags = append(diags, checkFrom(spec, cmd.block.commands, produced, true)...)
+		}
+		if sequence {
+			for _, name := range producedBy(cmd) {
+				produced[name] = true
+			}
+		}
+	}
+	return diags
+}
+
+// checkParamsFrom checks the context sources of one command's params.
+func checkParamsFrom(spec *routeSpec, cmd *commandSpec, produced map[string]bool) Diagnostics {
+	diags := Diagnostics{}
+	for _, p := range cmd.parameters {
+		for _, src := range parseFromStatement(p.from) {
+			switch src.source {
+			case "c", "cxt", "context":
+				if !produced[src.key] {
+					diags = append(diags, &Diagnostic{
+						Severity: SeverityWarning,
+						Route:    spec.name,
+						Command:  cmd.name,
+						Param:    p.name,
+						Message:  fmt.Sprintf("no earlier command produces context key '%s'", src.key),
+					})
+				}
+			}
+		}
+	}
+	return diags
+}
+
+// producedBy lists the context keys a command puts into the context.
+func producedBy(cmd *commandSpec) []string {
+	names := []string{cmd.name}
+	if cmd.block != nil {
+		for _, child := range cmd.block.commands {
+			names = append(names, producedBy(child)...)
+		}
+		return names
+	}
+	if cmd.command != nil && reflect.ValueOf(cmd.command).Pointer() == reflect.ValueOf(AddToContext).Pointer() {
+		for _, p := range cmd.parameters {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// allCommands lists commands along with every command inside of their
+// groups, in the order they were declared.
+func allCommands(cmds []*commandSpec) []*commandSpec {
+	all := make([]*commandSpec, 0, len(cmds))
+	for _, cmd := range cmds {
+		all = append(all, cmd)
+		if cmd.block != nil {
+			all = append(all, allCommands(cmd.block.commands)...)
+		}
+	}
+	return all
+}
+
+// validateCmdDef compares the Using params on a CmdDef to its fields.
+func validateCmdDef(spec *routeSpec, cmd *commandSpec) Diagnostics {
+	diags := Diagnostics{}
+	if cmd.def == nil {
+		return diags
+	}
+
+	t := reflect.Indirect(reflect.ValueOf(cmd.def)).Type()
+	if t.Kind() != reflect.Struct {
+		return diags
+	}
+
+	fields := map[string]bool{}
+	fieldNames := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := []string{f.Name}
+		if c := f.Tag.Get("coo"); len(c) > 0 {
+			tag = parseTag(f.Name, c)
+		}
+		if len(tag[0]) == 0 {
+			tag[0] = f.Name
+		}
+		if tag[0] == "-" {
+			continue
+		}
+		fromParams := len(tag) == 1
+		for _, mod := range tag[1:] {
+			if mod == "param" {
+				fromParams = true
+			}
+		}
+		if fromParams {
+			fields[tag[0]] = true
+			fieldNames = append(fieldNames, tag[0])
+		}
+	}
+
+	using := map[string]bool{}
+	for _, p := range cmd.parameters {
+		using[p.name] = true
+		if !fields[p.name] {
+			diags = append(diags, &Diagnostic{
+				Severity: SeverityError,
+				Route:    spec.name,
+				Command:  cmd.name,
+				Param:    p.name,
+				Message:  fmt.Sprintf("%s has no field for param '%s'", t.Name(), p.name),
+			})
+		}
+	}
+	for _, name := range fieldNames {
+		if !using[name] {
+			diags = append(diags, &Diagnostic{
+				Severity: SeverityWarning,
+				Route:    spec.name,
+				Command:  cmd.name,
+				Param:    name,
+				Message:  fmt.Sprintf("%s field '%s' has no Using param", t.Name(), name),
+			})
+		}
+	}
+	return diags
+}
+
+// validateTypes checks that typed params have a known type, and that their
+// defaults can be converted to it.
+func validateTypes(spec *routeSpec, cmd *commandSpec) Diagnostics {
+	diags := Diagnostics{}
+	for _, p := range cmd.parameters {
+		if len(p.typ) == 0 {
+			continue
+		}
+		if !IsParamType(p.typ) {
+			diags = append(diags, &Diagnostic{
+				Severity: SeverityError,
+				Route:    spec.name,
+				Command:  cmd.name,
+				Param:    p.name,
+				Message:  fmt.Sprintf("unknown param type %s", p.typ),
+			})
+			continue
+		}
+		if _, err := Coerce(p.defaultValue, p.typ); err != nil {
+			diags = append(diags, &Diagnostic{
+				Severity: SeverityError,
+				Route:    spec.name,
+				Command:  cmd.name,
+				Param:    p.name,
+				Message:  fmt.Sprintf("default %v is not a valid %s: %s", p.defaultValue, p.typ, err),
+			})
+		}
+	}
+	return diags
+}
@@ -0,0 +1,152 @@
+package cookoo
+
+import (
+	"strings"
+	"testing"
+)
+
+type validateDef struct {
+	Name  string
+	Age   int    `coo:"age"`
+	Hair  string `coo:"hair,cxt"`
+	Skip  string `coo:"-"`
+	Email string `coo:"email,cxt,param"`
+}
+
+func (v *validateDef) Run(c Context) (interface{}, Interrupt) {
+	return true, nil
+}
+
+// findDiag returns the first diagnostic whose message contains msg.
+func findDiag(diags Diagnostics, msg string) *Diagnostic {
+	for _, d := range diags {
+		if strings.Contains(d.Message, msg) {
+			return d
+		}
+	}
+	return nil
+}
+
+func TestValidateClean(t *testing.T) {
+	reg := NewRegistry()
+	reg.Route("@base", "Base").
+		Does(AddToContext, "setup").Using("user").WithDefault("matt").
+		Route("@fallback", "Errors").
+		Does(FetchParams, "report").Using("err").From("cxt:error").
+		Route("main", "Main").
+		OnError("@fallback").
+		Includes("@base").
+		Does(FetchParams, "one").Using("u").From("cxt:user").
+		Does(FetchParams, "two").Using("prev").From("cxt:one query:x").
+		Does(FetchParams, "three").Using("history").From("cxt:route.History").
+		Does(ForwardTo, "fwd").Using("route").WithDefault("@base")
+
+	if diags := reg.Validate(); len(diags) > 0 {
+		t.Errorf("! Expected no diagnostics, got:\n%s", diags)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	reg := NewRegistry()
+	reg.Route("dup", "First").Does(MockCommand, "a").
+		Route("dup", "Second").Does(MockCommand, "a").
+		Route("refs", "Bad references").
+		OnError("@nope").
+		Does(MockCommand, "one").Catch("@missing").
+		Does(ForwardTo, "fwd").Using("route").WithDefault("elsewhere").
+		Route("from", "Bad from").
+		Does(FetchParams, "early").Using("x").From("cxt:late").
+		Does(MockCommand, "late").
+		Route("@a", "Cycle").OnError("@b").Does(MockCommand, "a").
+		Route("@b", "Cycle").OnError("@a").Does(MockCommand, "b").
+		Route("aliased", "Alias is a route name").Alias("dup")
+	// Aliases cannot be removed, but a stale one should still be caught.
+	reg.aliases["stale"] = "gone"
+
+	reg.AddRoute(Route{
+		Name: "def",
+		Does: Tasks{
+			CmdDef{
+				Name: "person",
+				Def:  &validateDef{},
+				Using: Parameters{
+					{Name: "Name"},
+					{Name: "agee"},
+					{Name: "email"},
+				},
+			},
+		},
+	})
+
+	diags := reg.Validate()
+	errs := diags.Errors()
+	warns := diags.Warnings()
+
+	if d := findDiag(errs, "declared more than once"); d == nil || d.Route != "dup" {
+		t.Errorf("! Expected duplicate route error, got %v", d)
+	}
+	if d := findDiag(errs, "error handler '@nope'"); d == nil || d.Route != "refs" {
+		t.Errorf("! Expected missing handler error, got %v", d)
+	}
+	if d := findDiag(errs, "catch route '@missing'"); d == nil || d.Command != "one" {
+		t.Errorf("! Expected missing catch error, got %v", d)
+	}
+	if d := findDiag(errs, "reroute target 'elsewhere'"); d == nil || d.Command != "fwd" {
+		t.Errorf("! Expected missing reroute error, got %v", d)
+	}
+	if d := findDiag(errs, "route cycle: @a -> @b -> @a"); d == nil {
+		t.Errorf("! Expected cycle error, got:\n%s", errs)
+	}
+	if d := findDiag(errs, "no field for param 'agee'"); d == nil || d.Param != "agee" {
+		t.Errorf("! Expected CmdDef param error, got %v", d)
+	}
+	if d := findDiag(errs, "alias 'stale'"); d == nil || d.Route != "gone" {
+		t.Errorf("! Expected missing alias target error, got %v", d)
+	}
+	if d := findDiag(errs, "alias 'dup' is also a route name"); d == nil || d.Route != "aliased" {
+		t.Errorf("! Expected shadowed alias error, got %v", d)
+	}
+	if len(errs) != 8 {
+		t.Errorf("! Expected 8 errors, got:\n%s", errs)
+	}
+
+	if d := findDiag(warns, "context key 'late'"); d == nil || d.Param != "x" || d.Command != "early" {
+		t.Errorf("! Expected From warning, got %v", d)
+	}
+	if d := findDiag(warns, "field 'age' has no Using param"); d == nil {
+		t.Errorf("! Expected CmdDef field warning, got:\n%s", warns)
+	}
+	if len(warns) != 2 {
+		t.Errorf("! Expected 2 warnings, got:\n%s", warns)
+	}
+
+	line := findDiag(errs, "agee").Error()
+	if line != "error: route 'def', command 'person', param 'agee': validateDef has no field for param 'agee'" {
+		t.Errorf("! Unexpected diagnostic format: %s", line)
+	}
+}
+
+func TestValidateTypes(t *testing.T) {
+	reg := NewRegistry()
+	reg.Route("typed", "Typed params").
+		Does(FetchParams, "params").
+		Using("ok").WithType("int").WithDefault("5").
+		Using("bad").WithType("duration").WithDefault("soon")
+
+	errs := reg.Validate().Errors()
+	if len(errs) != 1 {
+		t.Fatalf("! Expected 1 error, got:\n%s", errs)
+	}
+	if errs[0].Param != "bad" || findDiag(errs, "not a valid duration") == nil {
+		t.Errorf("! Expected a bad default error, got %s", errs[0])
+	}
+	// An unknown type is an error even without a default. Typed and WithType
+	// refuse one, so put it in place directly.
+	spec, _ := reg.RouteSpec("typed")
+	cmd := spec.commands[0]
+	cmd.parameters = append(cmd.parameters, &paramSpec{name: "typo", typ: "itn"})
+	errs = reg.Validate().Errors()
+	if d := findDiag(errs, "unknown param type itn"); d == nil || d.Param != "typo" {
+		t.Errorf("! Expected an unknown type error, got:\n%s", errs)
+	}
+}
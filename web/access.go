@@ -0,0 +1,240 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+)
+
+// Access log formats, for the server.AccessLogFormat context value.
+const (
+	// CommonLogFormat is the NCSA Common Log Format:
+	//
+	// 	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326
+	CommonLogFormat = "common"
+	// CombinedLogFormat adds the referer and user agent to the common format.
+	CombinedLogFormat = "combined"
+	// JSONLogFormat writes one JSON object per request, with the duration,
+	// request ID and route as well.
+	JSONLogFormat = "json"
+)
+
+// ResponseTracker is an http.ResponseWriter that records the status code and
+// the size of the response.
+//
+// The CookooHandler puts one into the context as http.ResponseWriter, so the
+// access log can report what was sent. It passes Flush and Hijack through to
+// the writer it wraps.
+type ResponseTracker struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+// NewResponseTracker wraps an http.ResponseWriter.
+func NewResponseTracker(w http.ResponseWriter) *ResponseTracker {
+	return &ResponseTracker{ResponseWriter: w}
+}
+
+// WriteHeader records the status code and sends the header.
+func (t *ResponseTracker) WriteHeader(code int) {
+	if t.status == 0 {
+		t.status = code
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the number of bytes written.
+func (t *ResponseTracker) Write(p []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+	n, err := t.ResponseWriter.Write(p)
+	t.size += int64(n)
+	return n, err
+}
+
+// Status returns the status code sent. If nothing has been sent, it is
+// http.StatusOK, which is what the server will send.
+func (t *ResponseTracker) Status() int {
+	if t.status == 0 {
+		return http.StatusOK
+	}
+	return t.status
+}
+
+// Size returns the number of bytes in the body so far.
+func (t *ResponseTracker) Size() int64 {
+	return t.size
+}
+
+// Flush sends any buffered data, if the underlying writer can.
+func (t *ResponseTracker) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		if t.status == 0 {
+			t.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection, if the underlying writer allows it.
+func (t *ResponseTracker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := t.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+	if t.status == 0 {
+		t.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (t *ResponseTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// AccessLogger is a logger for the access log alone.
+//
+// A logger added to a context gets every message logged on the context. An
+// AccessLogger ignores those, and only writes the access log:
+//
+//	cxt.AddLogger("access", web.NewAccessLogger(accessFile))
+//
+// Without it, the access log's file would get the application's log messages
+// too.
+type AccessLogger struct {
+	writer io.Writer
+}
+
+// NewAccessLogger creates an AccessLogger that writes to the given writer.
+func NewAccessLogger(w io.Writer) *AccessLogger {
+	return &AccessLogger{writer: w}
+}
+
+// Write discards messages that are not from the access log.
+func (a *AccessLogger) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// accessLogMutex keeps access log lines from different requests from being
+// interleaved, since loggers are not required to be safe for concurrent use.
+var accessLogMutex sync.Mutex
+
+// logAccess writes an access log line for a request, if the context has a
+// logger with the name in server.AccessLog ("access" by default).
+func logAccess(cxt cookoo.Context, req *http.Request, res *ResponseTracker, start time.Time) {
+	name := cxt.Get("server.AccessLog", "access").(string)
+	logger, ok := cxt.Logger(name)
+	if !ok || logger == nil {
+		return
+	}
+	if al, ok := logger.(*AccessLogger); ok {
+		logger = al.writer
+	}
+	duration := time.Since(start)
+	format := cxt.Get("server.AccessLogFormat", CombinedLogFormat).(string)
+
+	var b bytes.Buffer
+	switch format {
+	case JSONLogFormat:
+		writeJSONAccess(&b, cxt, req, res, start, duration)
+	case CommonLogFormat:
+		writeCommonAccess(&b, req, res, start)
+	default:
+		writeCommonAccess(&b, req, res, start)
+		fmt.Fprintf(&b, " %s %s", strconv.Quote(req.Referer()), strconv.Quote(req.UserAgent()))
+	}
+	b.WriteByte('\n')
+
+	accessLogMutex.Lock()
+	defer accessLogMutex.Unlock()
+	logger.Write(b.Bytes())
+}
+
+func writeCommonAccess(b *bytes.Buffer, req *http.Request, res *ResponseTracker, start time.Time) {
+	fmt.Fprintf(b, "%s - %s [%s] %s %d %s",
+		remoteHost(req),
+		dash(remoteUser(req)),
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(fmt.Sprintf("%s %s %s", req.Method, req.RequestURI, req.Proto)),
+		res.Status(),
+		dash(sizeString(res.Size())),
+	)
+}
+
+func writeJSONAccess(b *bytes.Buffer, cxt cookoo.Context, req *http.Request, res *ResponseTracker, start time.Time, duration time.Duration) {
+	entry := struct {
+		Time      string  `json:"time"`
+		Remote    string  `json:"remote"`
+		User      string  `json:"user,omitempty"`
+		Method    string  `json:"method"`
+		URI       string  `json:"uri"`
+		Proto     string  `json:"proto"`
+		Status    int     `json:"status"`
+		Size      int64   `json:"size"`
+		Duration  float64 `json:"duration_ms"`
+		Referer   string  `json:"referer,omitempty"`
+		UserAgent string  `json:"user_agent,omitempty"`
+		RequestID string  `json:"request_id,omitempty"`
+		Route     string  `json:"route,omitempty"`
+	}{
+		Time:      start.Format(time.RFC3339Nano),
+		Remote:    remoteHost(req),
+		User:      remoteUser(req),
+		Method:    req.Method,
+		URI:       req.RequestURI,
+		Proto:     req.Proto,
+		Status:    res.Status(),
+		Size:      res.Size(),
+		Duration:  float64(duration) / float64(time.Millisecond),
+		Referer:   req.Referer(),
+		UserAgent: req.UserAgent(),
+		RequestID: fmt.Sprint(cxt.Get(cookoo.RequestIDKey, "")),
+		Route:     fmt.Sprint(cxt.Get("route.Name", "")),
+	}
+	data, _ := json.Marshal(entry)
+	b.Write(data)
+}
+
+func remoteHost(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return dash(req.RemoteAddr)
+}
+
+func remoteUser(req *http.Request) string {
+	if user, _, ok := req.BasicAuth(); ok {
+		return user
+	}
+	if req.URL != nil && req.URL.User != nil {
+		return req.URL.User.Username()
+	}
+	return ""
+}
+
+func sizeString(size int64) string {
+	if size == 0 {
+		return ""
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+func dash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
@@ -113,6 +113,19 @@ func Flush(cxt cookoo.Context, params *cookoo.Params) (interface{}, cookoo.Inter
 // 	  is actually a bytes.Buffer.) To flush the contents directly to the client, you can
 // 	  use `.Using('writer').From('http.ResponseWriter')`.
 //
+// Templates can build URLs from route names or aliases with the "url"
+// function, as in `{{url "user.show" "id" .ID}}` (see cookoo.Registry.URL).
+// The function must exist when the template is parsed, so parse templates
+// with TemplateFuncs:
+//
+// 	tpl := template.Must(template.New("").Funcs(web.TemplateFuncs(nil)).ParseGlob("*.html"))
+//
+// When the context has a Registry (see cookoo.RegistryKey, which the
+// CookooHandler sets), RenderHTML runs a copy of the template with "url"
+// bound to it. The template itself is not changed, so one template can be
+// shared by any number of requests at once. A template that has already been
+// run somewhere else cannot be copied, and is run as it is.
+//
 // Returns
 // 	- An io.Writer. The template's contents have already been written into the writer.
 //
@@ -147,6 +160,13 @@ func RenderHTML(cxt cookoo.Context, params *cookoo.Params) (interface{}, cookoo.
 	tplName := params.Get("templateName", nil).(string)
 	tpl := params.Get("template", nil).(*template.Template)
 	vals := params.Get("values", cxt.AsMap())
+	if reg, ok := cxt.Get(cookoo.RegistryKey, nil).(*cookoo.Registry); ok && reg != nil {
+		if clone, err := tpl.Clone(); err == nil {
+			tpl = clone.Funcs(TemplateFuncs(reg))
+		} else {
+			cxt.Logf("warn", "Could not bind url for template %s: %s", tplName, err)
+		}
+	}
 
 	err := tpl.ExecuteTemplate(out, tplName, vals)
 	if err != nil {
@@ -158,6 +178,24 @@ func RenderHTML(cxt cookoo.Context, params *cookoo.Params) (interface{}, cookoo.
 	return out, nil
 }
 
+// TemplateFuncs returns the functions RenderHTML provides to templates:
+//
+// 	- url: Builds a URL from a route name or alias and name/value pairs, using
+// 	  Registry.URL. `{{url "user.show" "id" 5}}` gives "/users/5".
+//
+// Add them to a template before it is parsed. With a nil registry, url
+// returns an error unless RenderHTML binds it to the context's Registry.
+func TemplateFuncs(reg *cookoo.Registry) template.FuncMap {
+	return template.FuncMap{
+		"url": func(name string, params ...interface{}) (string, error) {
+			if reg == nil {
+				return "", fmt.Errorf("No registry to build the URL for %s", name)
+			}
+			return reg.URL(name, params...)
+		},
+	}
+}
+
 // ServerInfo gets the server info for this request.
 //
 // This assumes that `http.Request` and `http.ResponseWriter` are in the context, which
@@ -280,3 +318,44 @@ func ServeFiles(cxt cookoo.Context, params *cookoo.Params) (interface{}, cookoo.
 	}
 	return nil, &cookoo.Reroute{"@404"}
 }
+
+// Metrics writes the metrics kept by a cookoo.MetricsTracer, in the
+// Prometheus text format.
+//
+// 	router.AddTracer(cookoo.NewMetricsTracer())
+// 	registry.Route("GET /metrics", "Serve metrics").
+// 		Does(web.Metrics, "metrics")
+//
+// Params:
+// 	- metrics: The *cookoo.MetricsTracer. By default, the one in the context under
+// 	  cookoo.MetricsKey is used. (A MetricsTracer on the router puts itself there.)
+// 	- writer: An http.ResponseWriter. This will try to write to the HTTP response if no writer
+// 	  is specified.
+//
+// Returns:
+// 	- boolean true
+func Metrics(cxt cookoo.Context, params *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	m, ok := params.Has("metrics")
+	if m == nil {
+		m, ok = cxt.Has(cookoo.MetricsKey)
+		if !ok {
+			return nil, &cookoo.FatalError{"No metrics tracer found. Add a cookoo.MetricsTracer to the router."}
+		}
+	}
+	metrics := m.(*cookoo.MetricsTracer)
+
+	writer, ok := params.Has("writer")
+	if writer == nil {
+		writer, ok = cxt.Has("http.ResponseWriter")
+		if !ok {
+			return false, nil
+		}
+	}
+	out := writer.(http.ResponseWriter)
+
+	out.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := metrics.WriteTo(out); err != nil {
+		return nil, &cookoo.RecoverableError{fmt.Sprintf("Error writing metrics: %s", err)}
+	}
+	return true, nil
+}
@@ -131,6 +131,28 @@ func (d *PathDatasource) Value(name string) interface{} {
 	return d.PathParts[index]
 }
 
+// RouteDatasource holds the path parameters of the matched route.
+//
+// For the route "GET /users/{id}", a request for "/users/42" gives the value
+// "42" for the name "id". Values are always strings. An unknown name gives
+// nil, so a default can be used.
+type RouteDatasource struct {
+	Params map[string]string
+}
+
+func (d *RouteDatasource) Init(params map[string]string) *RouteDatasource {
+	d.Params = params
+	return d
+}
+
+func (d *RouteDatasource) Value(name string) interface{} {
+	v, ok := d.Params[name]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
 // This provides a datasource for session data.
 //
 // Sessions differ a little from the other web datasources in that they may
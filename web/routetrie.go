@@ -0,0 +1,269 @@
+package web
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// routeTrie matches request names against route names, one path segment at a
+// time.
+//
+// A route name is split on "/". The first part is the verb ("GET ", "* ", or
+// "" for a route with no verb), and is matched last. The rest are path
+// segments, each of which is an edge in the trie. A trailing "**" segment is
+// not an edge; it marks the route as matching the whole subtree.
+//
+// At each node, children are tried from the most specific to the least:
+// literal segments, parameters with an expression, plain parameters, glob
+// patterns, and finally subtree routes. If a branch does not lead to a match,
+// the next one is tried. Ties are broken by the order the routes were added.
+type routeTrie struct {
+	root *trieNode
+	// catchAll is the first route named "**", if any. It matches anything, so
+	// it is tried after everything else.
+	catchAll string
+}
+
+type trieNode struct {
+	literals map[string]*trieNode
+	exprs    []*trieEdge
+	params   []*trieEdge
+	globs    []*trieEdge
+	// routes end at this node. subtree routes end in "/**" here.
+	routes  []*trieRoute
+	subtree []*trieRoute
+}
+
+// trieEdge is an edge for a parameter or glob segment.
+type trieEdge struct {
+	segment string
+	param   string
+	expr    *regexp.Regexp
+	node    *trieNode
+}
+
+type trieRoute struct {
+	name string
+	// verb is the first part of the route name, including the space.
+	verb string
+	glob bool
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{literals: map[string]*trieNode{}}
+}
+
+// buildTrie compiles route names into a trie. The names should be in the order
+// they were added.
+func buildTrie(names []string) (*routeTrie, error) {
+	t := &routeTrie{root: newTrieNode()}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if name == "**" {
+			if len(t.catchAll) == 0 {
+				t.catchAll = name
+			}
+			continue
+		}
+
+		segs := strings.Split(name, "/")
+		route := &trieRoute{name: name, verb: segs[0], glob: isGlob(segs[0])}
+		if _, err := path.Match(route.verb, ""); err != nil {
+			return nil, fmt.Errorf("Bad route pattern %s: %s", name, err)
+		}
+		segs = segs[1:]
+		subtree := len(segs) > 0 && segs[len(segs)-1] == "**"
+		if subtree {
+			segs = segs[:len(segs)-1]
+		}
+
+		n := t.root
+		for _, seg := range segs {
+			var err error
+			if n, err = n.child(seg); err != nil {
+				return nil, fmt.Errorf("Bad route pattern %s: %s", name, err)
+			}
+		}
+		if subtree {
+			n.subtree = append(n.subtree, route)
+		} else {
+			n.routes = append(n.routes, route)
+		}
+	}
+	return t, nil
+}
+
+// child returns the node for a segment, adding it if needed.
+func (n *trieNode) child(seg string) (*trieNode, error) {
+	if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+		name := seg[1 : len(seg)-1]
+		var expr *regexp.Regexp
+		edges := &n.params
+		if c := strings.Index(name, ":"); c >= 0 {
+			var err error
+			if expr, err = regexp.Compile("^(?:" + name[c+1:] + ")$"); err != nil {
+				return nil, err
+			}
+			name = name[:c]
+			edges = &n.exprs
+		}
+		return addEdge(edges, &trieEdge{segment: seg, param: name, expr: expr}), nil
+	}
+	if isGlob(seg) {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+		return addEdge(&n.globs, &trieEdge{segment: seg}), nil
+	}
+	c, ok := n.literals[seg]
+	if !ok {
+		c = newTrieNode()
+		n.literals[seg] = c
+	}
+	return c, nil
+}
+
+func addEdge(edges *[]*trieEdge, e *trieEdge) *trieNode {
+	for _, old := range *edges {
+		if old.segment == e.segment {
+			return old.node
+		}
+	}
+	e.node = newTrieNode()
+	*edges = append(*edges, e)
+	return e.node
+}
+
+func isGlob(seg string) bool {
+	return strings.ContainsAny(seg, `*?[\`)
+}
+
+// match finds the most specific route for a request name, and the values of
+// its path parameters.
+func (t *routeTrie) match(name string) (string, map[string]string, bool) {
+	segs := strings.Split(name, "/")
+	params := map[string]string{}
+	if r := t.root.match(segs[0], segs[1:], params); r != nil {
+		return r.name, params, true
+	}
+	if len(t.catchAll) > 0 {
+		return t.catchAll, params, true
+	}
+	return "", nil, false
+}
+
+func (n *trieNode) match(verb string, parts []string, params map[string]string) *trieRoute {
+	if len(parts) == 0 {
+		if r := pickVerb(n.routes, verb); r != nil {
+			return r
+		}
+		return pickVerb(n.subtree, verb)
+	}
+
+	part, rest := parts[0], parts[1:]
+	if c, ok := n.literals[part]; ok {
+		if r := c.match(verb, rest, params); r != nil {
+			return r
+		}
+	}
+	if len(part) > 0 {
+		for _, edges := range [][]*trieEdge{n.exprs, n.params} {
+			for _, e := range edges {
+				if e.expr != nil && !e.expr.MatchString(part) {
+					continue
+				}
+				old, had := params[e.param]
+				params[e.param] = part
+				if r := e.node.match(verb, rest, params); r != nil {
+					return r
+				}
+				if had {
+					params[e.param] = old
+				} else {
+					delete(params, e.param)
+				}
+			}
+		}
+	}
+	for _, e := range n.globs {
+		if ok, _ := path.Match(e.segment, part); ok {
+			if r := e.node.match(verb, rest, params); r != nil {
+				return r
+			}
+		}
+	}
+	return pickVerb(n.subtree, verb)
+}
+
+// pickVerb returns the first route whose verb is the given verb or, failing
+// that, the first whose verb pattern matches it.
+func pickVerb(routes []*trieRoute, verb string) *trieRoute {
+	for _, r := range routes {
+		if !r.glob && r.verb == verb {
+			return r
+		}
+	}
+	for _, r := range routes {
+		if r.glob {
+			if ok, _ := path.Match(r.verb, verb); ok {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// allowed returns the verbs of the routes that match the request's path,
+// whatever their verb. Only routes with a plain verb are counted.
+func (t *routeTrie) allowed(name string) []string {
+	segs := strings.Split(name, "/")
+	seen := map[string]bool{}
+	t.root.walk(segs[1:], func(routes []*trieRoute) {
+		for _, r := range routes {
+			if v := strings.TrimSpace(r.verb); !r.glob && len(v) > 0 && r.verb == v+" " {
+				seen[v] = true
+			}
+		}
+	})
+	allowed := make([]string, 0, len(seen))
+	for v := range seen {
+		allowed = append(allowed, v)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// walk calls fn with the routes of every node that matches the path.
+func (n *trieNode) walk(parts []string, fn func([]*trieRoute)) {
+	fn(n.subtree)
+	if len(parts) == 0 {
+		fn(n.routes)
+		return
+	}
+	part, rest := parts[0], parts[1:]
+	if c, ok := n.literals[part]; ok {
+		c.walk(rest, fn)
+	}
+	if len(part) > 0 {
+		for _, edges := range [][]*trieEdge{n.exprs, n.params} {
+			for _, e := range edges {
+				if e.expr == nil || e.expr.MatchString(part) {
+					e.node.walk(rest, fn)
+				}
+			}
+		}
+	}
+	for _, e := range n.globs {
+		if ok, _ := path.Match(e.segment, part); ok {
+			e.node.walk(rest, fn)
+		}
+	}
+}
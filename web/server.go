@@ -1,9 +1,17 @@
 package web
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"github.com/Masterminds/cookoo"
+	"github.com/Masterminds/cookoo/span"
 	"net/http"
 	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"os"
 	"os/signal"
@@ -19,16 +27,26 @@ import (
 // 	  * path: A PathDatasource (Provides access to parts of a path. E.g. "/foo/bar")
 // 	  * query: A QueryParameterDatasource (Provides access to URL query parameters.)
 // 	  * post: A FormValuesDatasource (Provides access to form data or the body of a request.)
+// 	  * route: A RouteDatasource (Provides access to path parameters, like "id" in "GET /users/{id}")
 // 	- The following context variables are set:
 // 	  * http.Request: A pointer to the http.Request object
-// 	  * http.ResponseWriter: The response writer.
+// 	  * http.ResponseWriter: The response writer (a ResponseTracker)
+// 	  * context.Context: The request's context.Context (see cookoo.StdContext)
+// 	  * request.ID: The request's ID (see RequestIDHeader)
+// 	  * cookoo.Registry: The registry, for building URLs (see cookoo.URLFunc)
+// 	  * trace.Root, trace.Parent: The W3C trace context (see span.Propagate)
 // 	  * server.Address: The server's address and port (NOT ALWAYS PRESENT)
 // 	- The handler includes logic to redirect "not found" errors to a path named "@404" if present.
+// 	- If a path matches a route for a different verb, the handler responds with a 405 Method Not
+// 	  Allowed, or runs the route "@405" if present.
 //
 // Context Params:
 //
 // 	- server.Address: If this key exists in the context, it will be used to determine the host/port the
 //   server runes on. EXPERIMENTAL. Default is ":8080".
+// 	- server.AccessLog: The name of the logger that gets the access log. Default is "access". If the
+// 	  context has no logger by that name, no access log is written. (See AccessLogger.)
+// 	- server.AccessLogFormat: "common", "combined" or "json". Default is "combined".
 //
 // Example:
 //
@@ -162,9 +180,25 @@ type CookooHandler struct {
 //   * path: A PathDatasource (Provides access to parts of a path. E.g. "/foo/bar")
 //   * query: A QueryParameterDatasource (Provides access to URL query parameters.)
 //   * post: A FormValuesDatasource (Provides access to form data or the body of a request.)
+//   * route: A RouteDatasource (Provides access to path parameters. See URIPathResolver.)
 // - The following context variables are set:
 //   * http.Request: A pointer to the http.Request object
-//   * http.ResponseWriter: The response writer.
+//   * http.ResponseWriter: The response writer, wrapped in a ResponseTracker
+//     to record the status and size of the response.
+//   * context.Context: The request's context.Context. When the client
+//     disconnects, the route stops before running its next command.
+//   * request.ID: The request's ID, taken from the X-Request-ID header or
+//     generated. It starts every log message for the request, and is sent
+//     back in the X-Request-ID response header.
+//   * cookoo.Registry: The handler's Registry, which the "url" template
+//     function uses to build URLs (see cookoo.Registry.URL).
+//   * trace.Root, trace.Parent: The trace context, read from the W3C
+//     traceparent header. A span.Tracer on the router uses it, so the
+//     route's span joins the caller's trace. The root span's traceparent is
+//     sent back in the traceparent response header.
+// - After each request, a line is written to the access log, if the context
+//   has a logger named by server.AccessLog ("access" by default). The
+//   format is set by server.AccessLogFormat (see CombinedLogFormat).
 //   * server.Address: The server's address and port (NOT ALWAYS PRESENT)
 func NewCookooHandler(reg *cookoo.Registry, router *cookoo.Router, cxt cookoo.Context) *CookooHandler {
 	handler := new(CookooHandler)
@@ -195,14 +229,23 @@ func (h *CookooHandler) addDatasources(cxt cookoo.Context, req *http.Request) {
 	cxt.AddDatasource("post", formDS)
 	cxt.AddDatasource("path", pathDS)
 	cxt.AddDatasource("header", headerDS)
+	// The resolver replaces this if the route has path parameters.
+	cxt.AddDatasource("route", new(RouteDatasource).Init(map[string]string{}))
 }
 
 // ServeHTTP is the Cookoo request handling function.
 //
 // This is capable of handling HTTP and HTTPS requests.
 func (h *CookooHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	// Track what is sent, for the access log.
+	start := time.Now()
+	tracker := NewResponseTracker(res)
+	res = tracker
+
 	// First we need to clone the context so we have a mutable copy.
 	cxt := h.BaseContext.Copy()
+	// This runs last, after any panic has been turned into a 500.
+	defer logAccess(cxt, req, tracker, start)
 	// Trap panics and make them 500 errors:
 	defer func() {
 		// fmt.Printf("Deferred function executed for path %s\n", req.URL.Path)
@@ -210,25 +253,36 @@ func (h *CookooHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			//log.Printf("FOUND ERROR: %v", err)
 			where := cxt.Get("command.Name", "<unknown>").(string)
 			rname := cxt.Get("route.Name", "<unknown>").(string)
-			h.BaseContext.Logf("error", "CookooHandler trapped a panic on route '%s' in command '%s': %v", rname, where, err)
+			cxt.Logf("error", "CookooHandler trapped a panic on route '%s' in command '%s': %v", rname, where, err)
 
 			// Buffer for a stack trace.
 			// This is pretty much always worthless, as the stack has been
 			// unwound up to here.
 			stack := make([]byte, 8192)
 			size := runtime.Stack(stack, false)
-			h.BaseContext.Logf("error", "Stack: %s", stack[:size])
+			cxt.Logf("error", "Stack: %s", stack[:size])
 
 			if size == 8192 {
-				h.BaseContext.Logf("error", "<truncated stack trace at 8192 bytes>")
+				cxt.Logf("error", "<truncated stack trace at 8192 bytes>")
 			}
 
 			http.Error(res, "An internal error occurred.", http.StatusInternalServerError)
 		}
 	}()
 
+	// Tag the request, so its log messages can be told apart from others.
+	id := req.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = NewRequestID()
+	}
+	cxt.Put(cookoo.RequestIDKey, id)
+	res.Header().Set(RequestIDHeader, id)
+	res.Header().Set("traceparent", span.Propagate(cxt, req.Header.Get("traceparent")))
+
 	cxt.Put("http.Request", req)
+	cxt.Put(cookoo.RegistryKey, h.Registry)
 	cxt.Put("http.ResponseWriter", res)
+	cookoo.SetStdContext(cxt, req.Context())
 
 	// Next, we add the datasources for URL and Query params.
 	h.addDatasources(cxt, req)
@@ -252,6 +306,24 @@ func (h *CookooHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 				http.NotFound(res, req)
 			}
 			return
+		// The path exists, but not for this verb.
+		case *MethodNotAllowedError:
+			cxt.Logf("info", "(recovering) %s", err)
+			res.Header().Set("Allow", strings.Join(err.(*MethodNotAllowedError).Allowed, ", "))
+			if h.Router.HasRoute("@405") {
+				h.Router.HandleRequest("@405", cxt, false)
+			} else {
+				http.Error(res, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			}
+			return
+		// The client went away or the deadline passed. There is no point in
+		// running @500 for a request nobody is waiting on.
+		case *cookoo.Canceled:
+			cxt.Logf("info", "Aborted route '%s': %s", path, err)
+			if err.(*cookoo.Canceled).Err == context.DeadlineExceeded {
+				http.Error(res, "The request timed out.", http.StatusServiceUnavailable)
+			}
+			return
 		// For any other, we go to a 500.
 		case *cookoo.FatalError:
 			cxt.Logf("error", "Fatal Error on route '%s': %s", path, err)
@@ -269,3 +341,39 @@ func (h *CookooHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		}
 	}
 }
+
+// RequestIDHeader is the header that carries a request's ID.
+//
+// If a request has this header (set, say, by a load balancer), its value is
+// used as the request ID. Otherwise, an ID is generated with NewRequestID.
+// Either way, the ID is sent back in the response under the same header.
+const RequestIDHeader = "X-Request-ID"
+
+// NewRequestID generates an ID for a request that did not come with one.
+//
+// By default, it returns 16 random hex digits. Replace it to use IDs of
+// another kind.
+var NewRequestID = func() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to a value that is at least unique in this process.
+		return fmt.Sprintf("%x-%x", time.Now().UnixNano(), atomic.AddUint64(&requestCounter, 1))
+	}
+	return hex.EncodeToString(b)
+}
+
+var requestCounter uint64
+
+// validRequestID checks a request ID from a client. It must be short, and
+// made only of printable characters, so it cannot garble the logs.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,296 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Masterminds/cookoo"
+	"github.com/Masterminds/cookoo/span"
+)
+
+func fail(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	return nil, &cookoo.FatalError{"boom"}
+}
+
+func TestRequestID(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	var logs bytes.Buffer
+	cxt.AddLogger("buffer", &logs)
+
+	reg.Route("GET /ok", "Works.").
+		Does(Flush, "out").Using("content").From("cxt:request.ID")
+	reg.Route("GET /fail", "Fails.").
+		Does(fail, "fail")
+	handler := NewCookooHandler(reg, router, cxt)
+
+	// An ID from the client is used and echoed.
+	req, _ := http.NewRequest("GET", "/ok", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Header().Get(RequestIDHeader) != "abc-123" || res.Body.String() != "abc-123" {
+		t.Errorf("! Expected the client's ID, got header %q and body %q", res.Header().Get(RequestIDHeader), res.Body.String())
+	}
+	if !strings.Contains(logs.String(), "[abc-123] Handling request for GET /ok") {
+		t.Errorf("! Expected log lines tagged with the ID, got %q", logs.String())
+	}
+
+	// A bad ID is replaced.
+	req.Header.Set(RequestIDHeader, "two words")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if id := res.Header().Get(RequestIDHeader); len(id) != 16 || id != res.Body.String() {
+		t.Errorf("! Expected a generated ID, got %q", id)
+	}
+
+	// Errors still carry the ID.
+	for _, path := range []string{"/missing", "/fail"} {
+		req, _ = http.NewRequest("GET", path, nil)
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if len(res.Header().Get(RequestIDHeader)) == 0 {
+			t.Errorf("! Expected a request ID on the %d response for %s", res.Code, path)
+		}
+	}
+	if _, ok := cxt.Has(cookoo.RequestIDKey); ok {
+		t.Error("! Expected the base context to be left alone.")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	var access, logs bytes.Buffer
+	cxt.AddLogger("access", NewAccessLogger(&access))
+	cxt.AddLogger("buffer", &logs)
+
+	reg.Route("GET /hello", "Says hello.").
+		Does(Flush, "out").Using("content").WithDefault("Hello").Using("responseCode").WithDefault(201)
+	reg.Route("GET /panic", "Panics.").
+		Does(func(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+			panic("oops")
+		}, "panic")
+	handler := NewCookooHandler(reg, router, cxt)
+
+	req, _ := http.NewRequest("GET", "/hello?x=1", nil)
+	req.RequestURI = "/hello?x=1"
+	req.RemoteAddr = "10.0.0.1:5555"
+	req.Header.Set("User-Agent", "test/1.0")
+	req.SetBasicAuth("frank", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	expect := regexp.MustCompile(`^10\.0\.0\.1 - frank \[\d\d/\w{3}/\d{4}:\d\d:\d\d:\d\d [-+]\d{4}\] "GET /hello\?x=1 HTTP/1.1" 201 5 "" "test/1.0"\n$`)
+	if !expect.MatchString(access.String()) {
+		t.Errorf("! Unexpected combined log line %q", access.String())
+	}
+	if strings.Contains(access.String(), "Handling request") {
+		t.Error("! Expected the access log to skip other messages.")
+	}
+	if strings.Contains(logs.String(), "frank") {
+		t.Error("! Expected other loggers to skip the access log.")
+	}
+
+	// A panic is logged as a 500, in JSON.
+	access.Reset()
+	cxt.Put("server.AccessLogFormat", JSONLogFormat)
+	req, _ = http.NewRequest("GET", "/panic", nil)
+	req.RequestURI = "/panic"
+	req.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(access.Bytes(), &entry); err != nil {
+		t.Fatalf("! Expected JSON, got %q: %s", access.String(), err)
+	}
+	if entry["status"] != float64(500) || entry["request_id"] != "req-1" || entry["route"] != "GET /panic" {
+		t.Errorf("! Unexpected JSON entry %v", entry)
+	}
+	if _, ok := entry["duration_ms"].(float64); !ok {
+		t.Errorf("! Expected a duration, got %v", entry)
+	}
+
+	access.Reset()
+	cxt.Put("server.AccessLogFormat", CommonLogFormat)
+	req, _ = http.NewRequest("GET", "/nothing", nil)
+	req.RequestURI = "/nothing"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.HasSuffix(access.String(), `"GET /nothing HTTP/1.1" 404 19`+"\n") {
+		t.Errorf("! Unexpected common log line %q", access.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	router.AddTracer(cookoo.NewMetricsTracer())
+	reg.Route("GET /metrics", "Serves metrics.").
+		Does(Metrics, "metrics")
+	handler := NewCookooHandler(reg, router, cxt)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if i == 0 {
+			continue
+		}
+		if !strings.HasPrefix(res.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+			t.Errorf("! Unexpected content type %q", res.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(res.Body.String(), `cookoo_route_runs_total{route="GET /metrics"} 1`) {
+			t.Errorf("! Expected the first request to be counted, got:\n%s", res.Body.String())
+		}
+	}
+
+	// Requests that match no route are counted by their error.
+	for _, r := range []struct{ method, path, expect string }{
+		{"GET", "/nowhere", `cookoo_request_errors_total{type="RouteError"} 1`},
+		{"POST", "/metrics", `cookoo_request_errors_total{type="MethodNotAllowedError"} 1`},
+	} {
+		req, _ := http.NewRequest(r.method, r.path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		req, _ = http.NewRequest("GET", "/metrics", nil)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if !strings.Contains(res.Body.String(), r.expect) {
+			t.Errorf("! Expected %s after %s %s, got:\n%s", r.expect, r.method, r.path, res.Body.String())
+		}
+	}
+
+	// Without a tracer, the command fails.
+	reg, router, cxt = cookoo.Cookoo()
+	reg.Route("GET /metrics", "Serves metrics.").Does(Metrics, "metrics")
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	res := httptest.NewRecorder()
+	NewCookooHandler(reg, router, cxt).ServeHTTP(res, req)
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("! Expected a 500 without a tracer, got %d", res.Code)
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("GET /", "Index").Does(Flush, "out").Using("content").WithDefault("hi")
+	exp := &span.MemoryExporter{}
+	tracer := span.NewTracer(exp)
+	defer tracer.Close()
+	router.AddTracer(tracer)
+	handler := NewCookooHandler(reg, router, cxt)
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", parent)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	tracer.Flush()
+	tp := res.Header().Get("traceparent")
+	if !strings.HasPrefix(tp, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || tp == parent {
+		t.Errorf("! Expected a new span in the caller's trace, got %q", tp)
+	}
+	spans := exp.Spans()
+	root := spans[len(spans)-1]
+	if root.Name != "GET /" || root.Traceparent() != tp || root.Parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("! Expected the root span to match the response, got %+v", root)
+	}
+
+	// A fallback route gets a span of its own under the request's root.
+	reg.Route("GET /fail", "Fails").Does(fail, "fail")
+	reg.Route("@500", "Error page").Does(Flush, "out").Using("content").WithDefault("oops")
+	exp.Reset()
+	req, _ = http.NewRequest("GET", "/fail", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush()
+	byName := map[string]*span.Span{}
+	for _, s := range exp.Spans() {
+		byName[s.Name] = s
+	}
+	failed, fallback := byName["GET /fail"], byName["@500"]
+	if failed == nil || fallback == nil {
+		t.Fatalf("! Expected spans for the route and @500, got %v", byName)
+	}
+	if fallback.SpanID == failed.SpanID || fallback.Parent != failed.SpanID || fallback.TraceID != failed.TraceID {
+		t.Errorf("! Expected @500 under the request's root span, got %+v", fallback)
+	}
+
+	// Without a valid header, a new trace is started.
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "garbage")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if _, err := span.ParseTraceparent(res.Header().Get("traceparent")); err != nil {
+		t.Errorf("! Expected a valid traceparent, got %q", res.Header().Get("traceparent"))
+	}
+	if strings.Contains(res.Header().Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Error("! Expected a new trace ID.")
+	}
+}
+
+func TestRouteParams(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("GET /users/{id}", "Show a user").
+		Does(Flush, "out").Using("content").From("route:id")
+	reg.Route("PUT /users/{id}", "Update a user")
+	handler := NewCookooHandler(reg, router, cxt)
+
+	req, _ := http.NewRequest("GET", "/users/42", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Body.String() != "42" {
+		t.Errorf("! Expected the id in the body, got %q", res.Body.String())
+	}
+
+	req, _ = http.NewRequest("DELETE", "/users/42", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("! Expected a 405, got %d", res.Code)
+	}
+	if res.Header().Get("Allow") != "GET, PUT" {
+		t.Errorf("! Unexpected Allow header %q", res.Header().Get("Allow"))
+	}
+
+	req, _ = http.NewRequest("DELETE", "/nobody", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusNotFound {
+		t.Errorf("! Expected a 404, got %d", res.Code)
+	}
+}
+
+func TestRenderHTMLURL(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	tpl := template.Must(template.New("").Funcs(TemplateFuncs(nil)).Parse(
+		`{{define "page"}}<a href="{{url "user.show" "id" 5 "tab" "a b"}}">me</a>{{end}}`))
+
+	reg.Route("GET /users/{id}", "Show a user").Alias("user.show")
+	reg.Route("GET /", "Index").
+		Does(RenderHTML, "html").
+		Using("template").WithDefault(tpl).
+		Using("templateName").WithDefault("page").
+		Using("writer").From("cxt:http.ResponseWriter")
+	handler := NewCookooHandler(reg, router, cxt)
+
+	// Only the registry in the context builds the URL. The template is
+	// shared, so it must render more than once, and from many requests at
+	// the same time.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/", nil)
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			if expect := `<a href="/users/5?tab=a&#43;b">me</a>`; res.Body.String() != expect {
+				t.Errorf("! Expected %s, got %s", expect, res.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,9 +1,13 @@
 package web
 
 import (
+	"fmt"
 	"github.com/Masterminds/cookoo"
 	"path"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // Resolver for transforming a URI path into a route.
@@ -22,10 +26,35 @@ import (
 // - There are no constrainst on verb name. Thus, verbs like WebDAV's PROPSET are fine, too. Or you can
 //   make up your own.
 //
-// IMPORTANT! When it comes to matching route patterns against paths, ORDER IS
-// IMPORTANT. Routes are evaluated in order. So if two rules (/a/b* and /a/bc) are
-// both defined, the incomming request /a/bc will match whichever route is
-// defined first. See the unit tests for examples.
+// Precedence:
+// ===========
+//
+// The route names are compiled into a tree of path segments, so a request is
+// matched without scanning every route. When more than one route matches, the
+// most specific one wins. Paths are compared segment by segment, from the
+// left, and at each segment the order is:
+//
+// 1. A literal segment, like `bar`
+// 2. A parameter with an expression, like `{id:[0-9]+}` (see below)
+// 3. A parameter, like `{id}`
+// 4. A glob pattern, like `b*` or `[cft]ar`
+// 5. A trailing `/**`
+//
+// Verbs are compared only once the path has matched: a literal verb ("GET")
+// beats a pattern ("*"). A route named `**` comes after everything else. If
+// two routes are still tied (say, `/a/b*` and `/a/*c` for the request `/a/bc`),
+// the one defined first wins.
+//
+// The tree is rebuilt when routes are added to the registry.
+//
+// Compatibility Mode:
+// ===================
+//
+// Earlier versions tried the routes in the order they were defined, and took
+// the first match, so that `/a/*` defined before `/a/b` would win for the
+// request `/a/b`. Setting Ordered restores that behavior:
+//
+// 	router.RequestResolver().(*web.URIPathResolver).Ordered = true
 //
 // The `**` and `/**` Wildcards:
 // =============================
@@ -53,8 +82,53 @@ import (
 // The behavior for rules that contain `/**` anywhere other than the end
 // have undefined behavior.
 //
+// Path Parameters:
+// ================
+//
+// A whole path segment can be a named parameter, in braces. A parameter may
+// have a regular expression after a colon, which the whole segment must match:
+//
+// - `GET /users/{id}/posts/{slug}` matches "GET /users/42/posts/hello"
+// - `GET /users/{id:[0-9]+}` matches "GET /users/42", but not "GET /users/bob"
+//
+// Parameters can be mixed with the wildcards above, including a trailing `/**`.
+// When a route with parameters matches, their values are put into the "route"
+// datasource (a RouteDatasource), so commands can use them:
+//
+// 	reg.Route("GET /users/{id}", "Show a user").
+// 		Does(ShowUser, "user").Using("id").From("route:id")
+//
+// 405 Method Not Allowed:
+// =======================
+//
+// If no route matches, but a route for the same path with another verb does,
+// the resolver returns a *MethodNotAllowedError listing the verbs that would
+// have matched. The CookooHandler turns it into a 405 response.
+//
 type URIPathResolver struct {
+	// Ordered turns on compatibility mode, in which routes are tried in the
+	// order they were defined.
+	Ordered bool
+
 	registry *cookoo.Registry
+
+	mutex    sync.Mutex
+	patterns map[string]*paramPattern
+	trie     *routeTrie
+	version  uint64
+}
+
+// MethodNotAllowedError indicates that a path matched a route, but not with
+// the request's verb.
+type MethodNotAllowedError struct {
+	Path string
+	// Allowed lists the verbs that would have matched, sorted.
+	Allowed []string
+}
+
+// Error returns the error message.
+func (e *MethodNotAllowedError) Error() string {
+	return fmt.Sprintf("Method not allowed for %s (allowed: %s)", e.Path, strings.Join(e.Allowed, ", "))
 }
 
 // Creates a new URIPathResolver.
@@ -65,7 +139,10 @@ func NewURIPathResolver(reg *cookoo.Registry) *URIPathResolver {
 }
 
 func (r *URIPathResolver) Init(registry *cookoo.Registry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	r.registry = registry
+	r.trie = nil
 }
 
 // Resolve a path name based using path patterns.
@@ -73,10 +150,61 @@ func (r *URIPathResolver) Init(registry *cookoo.Registry) {
 // This resolver is designed to match path-like strings to path patterns. For example,
 // the path `/foo/bar/baz` may match routes like `/foo/*/baz` or `/foo/bar/*`
 func (r *URIPathResolver) Resolve(pathName string, cxt cookoo.Context) (string, error) {
+	if r.Ordered {
+		return r.resolveOrdered(pathName, cxt)
+	}
+
+	t, err := r.compiled()
+	if err != nil {
+		return pathName, err
+	}
+	if route, params, ok := t.match(pathName); ok {
+		if len(params) > 0 {
+			cxt.AddDatasource("route", new(RouteDatasource).Init(params))
+		}
+		return route, nil
+	}
+	if _, _, ok := splitVerb(pathName); ok {
+		if allowed := t.allowed(pathName); len(allowed) > 0 {
+			return pathName, &MethodNotAllowedError{pathName, allowed}
+		}
+	}
+	return pathName, &cookoo.RouteError{"Could not resolve route " + pathName}
+}
+
+// compiled returns the route trie, building it if the registry has changed.
+func (r *URIPathResolver) compiled() (*routeTrie, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.trie != nil && r.version == r.registry.Version() {
+		return r.trie, nil
+	}
+	t, err := buildTrie(r.registry.RouteNames())
+	if err != nil {
+		return nil, err
+	}
+	r.trie, r.version = t, r.registry.Version()
+	return t, nil
+}
+
+// resolveOrdered tries each route in the order it was defined.
+func (r *URIPathResolver) resolveOrdered(pathName string, cxt cookoo.Context) (string, error) {
 	// HTTP verb support naturally falls out of the fact that spaces in paths are legal in UNIXy systems, while
 	// illegal in URI paths. So presently we do no special handling for verbs. Yay for simplicity.
 	for _, pattern := range r.registry.RouteNames() {
 
+		if strings.Contains(pattern, "{") {
+			params, ok, err := r.paramMatch(pattern, pathName)
+			if err != nil {
+				return pathName, err
+			}
+			if ok {
+				cxt.AddDatasource("route", new(RouteDatasource).Init(params))
+				return pattern, nil
+			}
+			continue
+		}
+
 		if strings.HasSuffix(pattern, "**") {
 			ok := r.subtreeMatch(cxt, pathName, pattern)
 			if ok {
@@ -91,9 +219,137 @@ func (r *URIPathResolver) Resolve(pathName string, cxt cookoo.Context) (string,
 			return pathName, err
 		}
 	}
+	if allowed := r.allowedVerbs(pathName, cxt); len(allowed) > 0 {
+		return pathName, &MethodNotAllowedError{pathName, allowed}
+	}
 	return pathName, &cookoo.RouteError{"Could not resolve route " + pathName}
 }
 
+// allowedVerbs finds the verbs of routes that match the path with their own
+// verb in place of the request's.
+func (r *URIPathResolver) allowedVerbs(pathName string, cxt cookoo.Context) []string {
+	verb, p, ok := splitVerb(pathName)
+	if !ok {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, pattern := range r.registry.RouteNames() {
+		pverb, _, ok := splitVerb(pattern)
+		if !ok || pverb == verb || seen[pverb] || strings.ContainsAny(pverb, "*?[\\") {
+			continue
+		}
+		probe := pverb + " " + p
+		var matched bool
+		if strings.Contains(pattern, "{") {
+			_, matched, _ = r.paramMatch(pattern, probe)
+		} else if strings.HasSuffix(pattern, "**") && r.subtreeMatch(cxt, probe, pattern) {
+			matched = true
+		} else {
+			matched, _ = path.Match(pattern, probe)
+		}
+		if matched {
+			seen[pverb] = true
+		}
+	}
+	allowed := make([]string, 0, len(seen))
+	for v := range seen {
+		allowed = append(allowed, v)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// splitVerb splits "VERB /path" into its verb and path.
+func splitVerb(name string) (string, string, bool) {
+	i := strings.Index(name, " ")
+	if i <= 0 {
+		return "", name, false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// paramPattern is a route pattern with path parameters, split into segments.
+type paramPattern struct {
+	segments []string
+	// params holds, for each segment that is a parameter, its name.
+	params map[int]string
+	// exprs holds the regular expressions of parameters that have one.
+	exprs map[int]*regexp.Regexp
+	// subtree is true if the pattern ends in `/**`.
+	subtree bool
+}
+
+// compile parses a pattern, caching the result.
+func (r *URIPathResolver) compile(pattern string) (*paramPattern, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if pp, ok := r.patterns[pattern]; ok {
+		return pp, nil
+	}
+
+	pp := &paramPattern{params: map[int]string{}, exprs: map[int]*regexp.Regexp{}}
+	pp.segments = strings.Split(pattern, "/")
+	if last := len(pp.segments) - 1; last > 0 && pp.segments[last] == "**" {
+		pp.subtree = true
+		pp.segments = pp.segments[:last]
+	}
+	// The first segment is the verb, if any, so it is never a parameter.
+	for i := 1; i < len(pp.segments); i++ {
+		seg := pp.segments[i]
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		name := seg[1 : len(seg)-1]
+		if c := strings.Index(name, ":"); c >= 0 {
+			re, err := regexp.Compile("^(?:" + name[c+1:] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("Bad expression for parameter in %s: %s", pattern, err)
+			}
+			pp.exprs[i] = re
+			name = name[:c]
+		}
+		pp.params[i] = name
+	}
+
+	if r.patterns == nil {
+		r.patterns = map[string]*paramPattern{}
+	}
+	r.patterns[pattern] = pp
+	return pp, nil
+}
+
+// paramMatch matches a path against a pattern with path parameters, and
+// returns the parameters' values.
+func (r *URIPathResolver) paramMatch(pattern, pathName string) (map[string]string, bool, error) {
+	pp, err := r.compile(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+	parts := strings.Split(pathName, "/")
+	if len(parts) < len(pp.segments) || (!pp.subtree && len(parts) != len(pp.segments)) {
+		return nil, false, nil
+	}
+
+	params := make(map[string]string, len(pp.params))
+	for i, seg := range pp.segments {
+		part := parts[i]
+		if name, ok := pp.params[i]; ok {
+			if len(part) == 0 {
+				return nil, false, nil
+			}
+			if re, ok := pp.exprs[i]; ok && !re.MatchString(part) {
+				return nil, false, nil
+			}
+			params[name] = part
+			continue
+		}
+		if ok, err := path.Match(seg, part); !ok || err != nil {
+			return nil, false, err
+		}
+	}
+	return params, true, nil
+}
+
 func (r *URIPathResolver) subtreeMatch(c cookoo.Context, pathName, pattern string) bool {
 
 	if pattern == "**" {
@@ -3,6 +3,7 @@ package web
 import (
 	"fmt"
 	"github.com/Masterminds/cookoo"
+	"strings"
 	"testing"
 )
 
@@ -69,3 +70,166 @@ func TestUriPathResolver(t *testing.T) {
 		}
 	}
 }
+
+func TestUriPathResolverParams(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	router.SetRequestResolver(NewURIPathResolver(reg))
+
+	reg.Route("GET /users/new", "Literal segments still win when first")
+	reg.Route("GET /users/{id:[0-9]+}", "Numeric ID")
+	reg.Route("GET /users/{name}", "Any name")
+	reg.Route("GET /users/{id}/posts/{slug}", "Two params")
+	reg.Route("DELETE /users/{id}", "Other verb")
+	reg.Route("* /files/{dir}/**", "Param and subtree")
+
+	tests := []struct {
+		name, expects string
+		params        map[string]string
+	}{
+		{"GET /users/new", "GET /users/new", nil},
+		{"GET /users/42", "GET /users/{id:[0-9]+}", map[string]string{"id": "42"}},
+		{"GET /users/bob", "GET /users/{name}", map[string]string{"name": "bob"}},
+		{"GET /users/42/posts/hello", "GET /users/{id}/posts/{slug}", map[string]string{"id": "42", "slug": "hello"}},
+		{"DELETE /users/42", "DELETE /users/{id}", map[string]string{"id": "42"}},
+		{"PUT /files/img/a/b.png", "* /files/{dir}/**", map[string]string{"dir": "img"}},
+	}
+	for _, tt := range tests {
+		resolved, err := router.ResolveRequest(tt.name, cxt)
+		if err != nil {
+			t.Errorf("! Unexpected resolver error for %s: %s", tt.name, err)
+			continue
+		}
+		if resolved != tt.expects {
+			t.Errorf("! Expected `%s` to match `%s`; got `%s`", tt.name, tt.expects, resolved)
+		}
+		for k, v := range tt.params {
+			if got := cxt.Datasource("route").(*RouteDatasource).Value(k); got != v {
+				t.Errorf("! Expected route:%s to be %s for %s, got %v", k, v, tt.name, got)
+			}
+		}
+	}
+
+	if _, err := router.ResolveRequest("GET /users/", cxt); err == nil {
+		t.Error("! Expected an empty segment not to match a parameter.")
+	}
+
+	_, err := router.ResolveRequest("POST /users/42", cxt)
+	mna, ok := err.(*MethodNotAllowedError)
+	if !ok {
+		t.Fatalf("! Expected a MethodNotAllowedError, got %v", err)
+	}
+	if strings.Join(mna.Allowed, ",") != "DELETE,GET" {
+		t.Errorf("! Expected DELETE and GET to be allowed, got %v", mna.Allowed)
+	}
+	if _, err := router.ResolveRequest("POST /nothing", cxt); err == nil {
+		t.Error("! Expected an error for an unknown path.")
+	} else if _, ok := err.(*cookoo.RouteError); !ok {
+		t.Errorf("! Expected a RouteError for an unknown path, got %T", err)
+	}
+
+	reg.Route("GET /bad/{id:[}", "Bad expression")
+	if _, err := router.ResolveRequest("GET /bad/1", cxt); err == nil {
+		t.Error("! Expected an error for a bad expression.")
+	}
+}
+
+func TestUriPathResolverSpecificity(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	resolver := NewURIPathResolver(reg)
+	router.SetRequestResolver(resolver)
+
+	// Defined from least to most specific, so order cannot be what decides.
+	reg.Route("**", "Anything")
+	reg.Route("* /**", "Any verb, any path")
+	reg.Route("GET /a/**", "Subtree")
+	reg.Route("GET /a/*", "Glob")
+	reg.Route("GET /a/{name}", "Param")
+	reg.Route("GET /a/{id:[0-9]+}", "Param with expression")
+	reg.Route("* /a/b", "Literal, any verb")
+	reg.Route("GET /a/b", "Literal")
+	reg.Route("GET /a/*/c", "Glob, then literal")
+	reg.Route("GET /a/b*/d", "Tie, first")
+	reg.Route("GET /a/*d/d", "Tie, second")
+
+	tests := map[string]string{
+		"GET /a/b":       "GET /a/b",
+		"POST /a/b":      "* /a/b",
+		"GET /a/42":      "GET /a/{id:[0-9]+}",
+		"GET /a/bob":     "GET /a/{name}",
+		"GET /a/":        "GET /a/*",
+		"GET /a/b/c":     "GET /a/*/c",
+		"GET /a/bd/d":    "GET /a/b*/d",
+		"GET /a/b/c/d":   "GET /a/**",
+		"GET /a":         "GET /a/**",
+		"POST /a/x":      "* /**",
+		"not a path":     "**",
+		"GET /a/b/z":     "GET /a/**",
+		"DELETE /a/b/zz": "* /**",
+	}
+	for name, expects := range tests {
+		resolved, err := router.ResolveRequest(name, cxt)
+		if err != nil {
+			t.Errorf("! Unexpected resolver error for %s: %s", name, err)
+		}
+		if resolved != expects {
+			t.Errorf("! Expected `%s` to match `%s`; got `%s`", name, expects, resolved)
+		}
+	}
+
+	// In compatibility mode, the first route defined wins.
+	resolver.Ordered = true
+	if resolved, _ := router.ResolveRequest("GET /a/b", cxt); resolved != "**" {
+		t.Errorf("! Expected the first route in ordered mode, got `%s`", resolved)
+	}
+}
+
+func TestUriPathResolverRebuild(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+	router.SetRequestResolver(NewURIPathResolver(reg))
+
+	reg.Route("GET /a", "A")
+	if _, err := router.ResolveRequest("GET /b", cxt); err == nil {
+		t.Error("! Expected no route for /b yet.")
+	}
+	reg.Route("GET /b", "B")
+	if resolved, err := router.ResolveRequest("GET /b", cxt); err != nil || resolved != "GET /b" {
+		t.Errorf("! Expected the new route to be found, got `%s`, %v", resolved, err)
+	}
+
+	reg.Route("GET /[", "Bad pattern")
+	if _, err := router.ResolveRequest("GET /a", cxt); err == nil {
+		t.Error("! Expected an error for a bad pattern.")
+	}
+}
+
+// benchRegistry builds a registry with n resource routes, plus a catch-all.
+func benchRegistry(n int) (*cookoo.Registry, []string) {
+	reg := cookoo.NewRegistry()
+	requests := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		reg.Route(fmt.Sprintf("GET /r%d/{id}", i), "Show")
+		reg.Route(fmt.Sprintf("POST /r%d", i), "Create")
+		reg.Route(fmt.Sprintf("GET /r%d/*/files/**", i), "Files")
+		requests = append(requests, fmt.Sprintf("GET /r%d/%d/files/a/b.txt", i, i))
+	}
+	reg.Route("**", "Catch-all")
+	return reg, requests
+}
+
+func benchmarkResolve(b *testing.B, n int, ordered bool) {
+	reg, requests := benchRegistry(n)
+	resolver := NewURIPathResolver(reg)
+	resolver.Ordered = ordered
+	cxt := cookoo.NewContext()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := resolver.Resolve(requests[i%len(requests)], cxt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResolveTrie10(b *testing.B)     { benchmarkResolve(b, 10, false) }
+func BenchmarkResolveOrdered10(b *testing.B)  { benchmarkResolve(b, 10, true) }
+func BenchmarkResolveTrie500(b *testing.B)    { benchmarkResolve(b, 500, false) }
+func BenchmarkResolveOrdered500(b *testing.B) { benchmarkResolve(b, 500, true) }